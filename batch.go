@@ -0,0 +1,264 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrBatchAborted is the error of the calls of a batch which have not been
+// executed because a previous call failed
+var ErrBatchAborted = errors.New("batch aborted by a previous call")
+
+// Batch is a batch of calls executed in one round trip, see NewBatch
+type Batch struct {
+	p     *PgProc
+	calls []*BatchCall
+}
+
+// BatchCall is a call queued in a batch
+type BatchCall struct {
+	Schema string
+	Proc   string
+	Params []interface{}
+	Result interface{}
+	// Err is the error of the call, set by Run
+	Err error
+
+	inv   *Invocation
+	query string
+}
+
+// NewBatch returns an empty batch of calls:
+//
+//	batch := base.NewBatch()
+//	user := batch.Queue(&u, "api", "user_get", id)
+//	orders := batch.Queue(&o, "api", "user_orders", id)
+//	err := batch.Run(ctx)
+//	if user.Err != nil {
+//		...
+//	}
+func (p *PgProc) NewBatch() *Batch {
+	return &Batch{p: p}
+}
+
+// Queue queues a call, with its result stored as by Call, and returns it
+func (b *Batch) Queue(result interface{}, schema string, proc string, params ...interface{}) *BatchCall {
+	call := &BatchCall{Schema: schema, Proc: proc, Params: params, Result: result}
+	b.calls = append(b.calls, call)
+	return call
+}
+
+// Run executes the queued calls in one round trip, as a single query sent
+// to the primary, or to a replica if no function is VOLATILE, and sets the
+// error of each call. The calls failing before being sent, because of the
+// call policy or their parameters, are skipped. When a call fails in the
+// database, the next ones are not executed and fail with ErrBatchAborted,
+// and the changes of the batch are rolled back. The calls of a batch are
+// neither retried nor cached, and the middlewares are not called. The
+// executed calls are recorded in the statistics with the batch label,
+// with the latency of the batch.
+//
+// The channel results are closed when Run returns.
+//
+// Run returns the error of the first failing call, or nil.
+func (b *Batch) Run(ctx context.Context) (err error) {
+	p := b.p
+	ctx, span := p.startSpan(ctx, "batch",
+		Attribute{Key: "db.system", Value: "postgresql"},
+		Attribute{Key: "pgproc.calls", Value: len(b.calls)})
+	defer func() {
+		endSpan(span, err)
+	}()
+	for _, call := range b.calls {
+		if v := reflect.ValueOf(call.Result); v.Kind() == reflect.Chan {
+			defer v.Close()
+		}
+	}
+	start := time.Now()
+
+	var (
+		queued   []*BatchCall
+		readOnly = true
+	)
+	for _, call := range b.calls {
+		call.inv = &Invocation{Schema: call.Schema, Proc: call.Proc, Params: call.Params, Result: call.Result}
+		if call.Err = p.prepareBatchCall(ctx, call); call.Err == nil {
+			queued = append(queued, call)
+			readOnly = readOnly && call.inv.rt.volatility != "v"
+		}
+	}
+	if len(queued) > 0 {
+		p.runBatch(ctx, span, queued, readOnly)
+	}
+
+	// the rejected calls are not recorded, their names being unchecked
+	latency := time.Since(start)
+	for _, call := range queued {
+		p.metrics.record(call.inv, true, latency, call.Err)
+	}
+	for _, call := range b.calls {
+		if call.Err != nil && err == nil {
+			err = fmt.Errorf("%s.%s: %w", call.Schema, call.Proc, call.Err)
+		}
+	}
+	return err
+}
+
+// prepareBatchCall checks the call against the call policy, looks up its
+// return type and builds its query, with the parameters as literals
+func (p *PgProc) prepareBatchCall(ctx context.Context, call *BatchCall) error {
+	if err := p.checkPolicy(ctx, call.Schema, call.Proc, len(call.Params)); err != nil {
+		return err
+	}
+	rt, err := p.lookupReturnType(ctx, call.Schema, call.Proc, len(call.Params))
+	if err != nil {
+		return err
+	}
+	call.inv.ReturnType, call.inv.rt = rt.export(), rt
+	params, err := p.encodeParams(call.Params, rt.argTypes)
+	if err != nil {
+		return err
+	}
+	literals := make([]string, len(params))
+	for i, param := range params {
+		var typname string
+		if i < len(rt.argTypes) {
+			typname = rt.argTypes[i]
+		}
+		if literals[i], err = literal(param, typname); err != nil {
+			return fmt.Errorf("parameter %d: %s", i+1, err)
+		}
+	}
+	call.query = fmt.Sprintf("SELECT * FROM %s.%s(%s)",
+		pq.QuoteIdentifier(call.Schema),
+		pq.QuoteIdentifier(call.Proc),
+		strings.Join(literals, ", "))
+	return nil
+}
+
+// runBatch executes the queries of the calls as a single query, their
+// results being separated by markers, for an error to be attributed to the
+// call it comes from: an error read before the marker following a call
+// comes from the call
+func (p *PgProc) runBatch(ctx context.Context, span Span, calls []*BatchCall, readOnly bool) {
+	statements := make([]string, 0, 2*len(calls))
+	for i, call := range calls {
+		if i > 0 {
+			statements = append(statements, "SELECT "+strconv.Itoa(i))
+		}
+		statements = append(statements, call.query)
+	}
+	query := p.queryComment(ctx, span) + strings.Join(statements, ";\n")
+
+	q, end, err := p.begin(ctx, readOnly)
+	if err != nil {
+		for _, call := range calls {
+			call.Err = err
+		}
+		return
+	}
+	// without parameters, the statements are sent in one message
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		calls[0].Err = err
+		for _, call := range calls[1:] {
+			call.Err = ErrBatchAborted
+		}
+		end(err)
+		return
+	}
+	var aborted error
+	for i, call := range calls {
+		if aborted != nil {
+			call.Err = ErrBatchAborted
+			continue
+		}
+		if i > 0 {
+			// the marker separating the call from the previous one
+			if !rows.NextResultSet() || !skipResult(rows) || !rows.NextResultSet() {
+				aborted = resultSetError(rows)
+				call.Err = aborted
+				continue
+			}
+		}
+		call.Err = p.scanResult(ctx, rows, call.inv)
+		if !skipResult(rows) {
+			// the call failed in the database
+			aborted = rows.Err()
+			call.Err = aborted
+		}
+	}
+	rows.Close()
+	if err := end(aborted); err != nil && aborted == nil {
+		// the commit failed
+		for _, call := range calls {
+			if call.Err == nil {
+				call.Err = err
+			}
+		}
+	}
+}
+
+// skipResult reads the rows left in the current result set,
+// and returns false on error
+func skipResult(rows *sql.Rows) bool {
+	for rows.Next() {
+	}
+	return rows.Err() == nil
+}
+
+// resultSetError returns the error of rows when a result set is missing
+func resultSetError(rows *sql.Rows) error {
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return errors.New("result missing in the batch")
+}
+
+// literal returns the SQL literal of a parameter encoded for an argument
+// of the PostgreSQL type typname
+func literal(param interface{}, typname string) (string, error) {
+	value, err := driver.DefaultParameterConverter.ConvertValue(param)
+	if err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return pq.QuoteLiteral(v), nil
+	case []byte:
+		if typname == "bytea" {
+			return pq.QuoteLiteral(`\x` + hex.EncodeToString(v)), nil
+		}
+		return pq.QuoteLiteral(string(v)), nil
+	case time.Time:
+		return pq.QuoteLiteral(string(pq.FormatTimestamp(v))), nil
+	case bool:
+		return pq.QuoteLiteral(strconv.FormatBool(v)), nil
+	case int64:
+		return pq.QuoteLiteral(strconv.FormatInt(v, 10)), nil
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return "'Infinity'", nil
+		case math.IsInf(v, -1):
+			return "'-Infinity'", nil
+		case math.IsNaN(v):
+			return "'NaN'", nil
+		}
+		return pq.QuoteLiteral(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	}
+	return "", fmt.Errorf("cannot send %T in a batch", value)
+}
@@ -0,0 +1,98 @@
+package pgproc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLiteral(t *testing.T) {
+	i := 7
+	for _, c := range []struct {
+		param    interface{}
+		typname  string
+		expected string
+	}{
+		{nil, "int4", "NULL"},
+		{"it's", "text", "'it''s'"},
+		{`a\b`, "text", ` E'a\\b'`},
+		{[]byte{0, 255}, "bytea", ` E'\\x00ff'`},
+		{[]byte("{1,2}"), "_int4", "'{1,2}'"},
+		{true, "bool", "'true'"},
+		{&i, "int4", "'7'"},
+		{uint8(3), "int2", "'3'"},
+		{1.5, "float8", "'1.5'"},
+		{math.Inf(-1), "float8", "'-Infinity'"},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "timestamptz", "'2024-01-02 03:04:05Z'"},
+	} {
+		if s, err := literal(c.param, c.typname); err != nil || s != c.expected {
+			t.Errorf("Error literal of %v: %s %v, expected %s", c.param, s, err, c.expected)
+		}
+	}
+	if _, err := literal(struct{}{}, "text"); err == nil {
+		t.Errorf("Error expected struct not converted")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	batch := base.NewBatch()
+	var (
+		i      int
+		list   []int
+		item   Content
+		failed bool
+		after  int
+	)
+	calls := []*BatchCall{
+		batch.Queue(&i, "tests", "test_returns_incremented_integer", 41),
+		batch.Queue(&list, "tests", "test_returns_setof_integer"),
+		batch.Queue(&item, "tests", "test_returns_integer", 1),
+		batch.Queue(nil, "tests", "test_returns_integer"),
+	}
+	if err := batch.Run(context.Background()); err == nil {
+		t.Errorf("Error expected error of unknown function")
+	}
+	if calls[0].Err != nil || i != 42 || calls[1].Err != nil || len(list) != 3 || calls[3].Err != nil {
+		t.Errorf("Error in results: %d %v %v %v %v", i, list, calls[0].Err, calls[1].Err, calls[3].Err)
+	}
+	if calls[2].Err == nil {
+		t.Errorf("Error expected error of function not found")
+	}
+	batched := false
+	for _, s := range base.Stats() {
+		if s.Batch && s.Proc == "unknown" {
+			t.Errorf("Error rejected call recorded: %+v", s)
+		}
+		batched = batched || s.Batch && s.Proc == "test_returns_incremented_integer"
+	}
+	if !batched {
+		t.Errorf("Error expected batch call recorded")
+	}
+
+	batch = base.NewBatch()
+	calls = []*BatchCall{
+		batch.Queue(&i, "tests", "test_returns_integer"),
+		batch.Queue(&failed, "tests", "function_raising_exception"),
+		batch.Queue(&after, "tests", "test_returns_integer"),
+	}
+	err := batch.Run(context.Background())
+	if err == nil || sqlState(err) != "P0001" {
+		t.Errorf("Error expected exception: %v", err)
+	}
+	if calls[0].Err != nil || sqlState(calls[1].Err) != "P0001" || !errors.Is(calls[2].Err, ErrBatchAborted) {
+		t.Errorf("Error in errors: %v %v %v", calls[0].Err, calls[1].Err, calls[2].Err)
+	}
+
+	// the first statement fails
+	batch = base.NewBatch()
+	calls = []*BatchCall{
+		batch.Queue(&failed, "tests", "function_raising_exception"),
+		batch.Queue(&after, "tests", "test_returns_integer"),
+	}
+	batch.Run(context.Background())
+	if sqlState(calls[0].Err) != "P0001" || !errors.Is(calls[1].Err, ErrBatchAborted) {
+		t.Errorf("Error in errors: %v %v", calls[0].Err, calls[1].Err)
+	}
+}
@@ -0,0 +1,151 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Bind fills the func fields of the struct pointed to by api with
+// implementations calling the PostgreSQL procedures named in their
+// pgproc tag:
+//
+//	type API struct {
+//		ContentAdd func(ctx context.Context, name string) (int, error) `pgproc:"tests.content_add"`
+//		ContentGet func(id int) (Content, error)                        `pgproc:"tests.content_get"`
+//	}
+//
+// The first parameter of a func can be a context.Context, the other ones
+// are the parameters of the procedure. A func returns the result of the
+// procedure (a slice for a SETOF procedure) and an error, or only an error.
+//
+// The signature of each func is checked against the procedure once,
+// and no field is filled if a procedure does not exist or has
+// an incompatible signature.
+func Bind(p *PgProc, api interface{}) error {
+	v := reflect.ValueOf(api)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("api must be a pointer to a struct")
+	}
+	v = v.Elem()
+	var (
+		funcs = map[int]reflect.Value{}
+		errs  []string
+	)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag := field.Tag.Get("pgproc")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		fn, err := p.bindFunc(field.Type, tag)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s (%s): %s", field.Name, tag, err))
+			continue
+		}
+		funcs[i] = fn
+	}
+	if len(errs) > 0 {
+		return errors.New("cannot bind " + strings.Join(errs, "; "))
+	}
+	for i, fn := range funcs {
+		v.Field(i).Set(fn)
+	}
+	return nil
+}
+
+// bindFunc returns a func of type ft calling the procedure named
+// schema.proc, after checking ft against the procedure
+func (p *PgProc) bindFunc(ft reflect.Type, name string) (reflect.Value, error) {
+	schema, proc, err := splitName(name)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if ft.Kind() != reflect.Func {
+		return reflect.Value{}, errors.New("field is not a func")
+	}
+	if ft.IsVariadic() {
+		return reflect.Value{}, errors.New("variadic funcs are not supported")
+	}
+	withContext := ft.NumIn() > 0 && ft.In(0) == contextType
+	var params []reflect.Type
+	for i := 0; i < ft.NumIn(); i++ {
+		if i > 0 || !withContext {
+			params = append(params, ft.In(i))
+		}
+	}
+	withResult := ft.NumOut() == 2
+	if (ft.NumOut() != 1 && ft.NumOut() != 2) || ft.Out(ft.NumOut()-1) != errorType {
+		return reflect.Value{}, errors.New("func must return an error, or a result and an error")
+	}
+
+	if err := p.checkPolicy(context.Background(), schema, proc, len(params)); err != nil {
+		return reflect.Value{}, err
+	}
+	rt, err := p.getReturnType(context.Background(), schema, proc, len(params))
+	if err == sql.ErrNoRows {
+		return reflect.Value{}, fmt.Errorf("function with %d arguments not found", len(params))
+	}
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if err := p.checkParams(params, rt); err != nil {
+		return reflect.Value{}, err
+	}
+	if withResult {
+		if ft.Out(0).Kind() == reflect.Chan {
+			return reflect.Value{}, errors.New("result: use a slice instead of a channel")
+		}
+		if err := p.checkResult(ft.Out(0), rt); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+
+	return reflect.MakeFunc(ft, func(in []reflect.Value) []reflect.Value {
+		ctx := context.Background()
+		if withContext {
+			if c, ok := in[0].Interface().(context.Context); ok && c != nil {
+				ctx = c
+			}
+			in = in[1:]
+		}
+		args := make([]interface{}, len(in))
+		for i, arg := range in {
+			args[i] = arg.Interface()
+		}
+		var (
+			res    reflect.Value
+			result interface{}
+		)
+		if withResult {
+			res = reflect.New(ft.Out(0))
+			result = res.Interface()
+		}
+		err := p.CallContext(ctx, result, schema, proc, args...)
+		errValue := reflect.Zero(errorType)
+		if err != nil {
+			errValue = reflect.ValueOf(&err).Elem()
+		}
+		if withResult {
+			return []reflect.Value{res.Elem(), errValue}
+		}
+		return []reflect.Value{errValue}
+	}), nil
+}
+
+// splitName splits a schema-qualified procedure name
+func splitName(name string) (string, string, error) {
+	i := strings.IndexByte(name, '.')
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("'%s' is not a schema-qualified procedure name", name)
+	}
+	return name[:i], name[i+1:], nil
+}
@@ -0,0 +1,96 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+type testsAPI struct {
+	ContentAdd  func(ctx context.Context, name string) (int, error) `pgproc:"tests.content_add"`
+	ContentGet  func(id int) (Content, error)                       `pgproc:"tests.content_get"`
+	SetofString func(ctx context.Context) ([]string, error)         `pgproc:"tests.test_returns_setof_string"`
+	SameBool    func(b bool) error                                  `pgproc:"tests.test_returns_same_bool"`
+	NotBound    func() (int, error)
+}
+
+func TestBind(t *testing.T) {
+	var api testsAPI
+	if err := Bind(base, &api); err != nil {
+		t.Fatalf("Error binding: %s", err)
+	}
+	if api.NotBound != nil {
+		t.Errorf("Error expected untagged field to be left unbound")
+	}
+
+	id, err := api.ContentAdd(context.Background(), "bound")
+	if err != nil || id <= 0 {
+		t.Errorf("Error calling ContentAdd: %v", err)
+	}
+	content, err := api.ContentGet(id)
+	if err != nil || content.CntId != id || content.CntName != "bound" {
+		t.Errorf("Error calling ContentGet: %v %v", content, err)
+	}
+	strs, err := api.SetofString(context.Background())
+	if err != nil || len(strs) != 3 || strs[0] != "hello" {
+		t.Errorf("Error calling SetofString: %v %v", strs, err)
+	}
+	if err := api.SameBool(true); err != nil {
+		t.Errorf("Error calling SameBool: %v", err)
+	}
+}
+
+func TestBindMismatch(t *testing.T) {
+	var api struct {
+		Unknown    func() (int, error)                   `pgproc:"tests.unknown_function"`
+		WrongArity func(a, b int) (int, error)           `pgproc:"tests.test_returns_incremented_integer"`
+		WrongParam func(b bool) (int, error)             `pgproc:"tests.test_returns_incremented_integer"`
+		WrongRes   func() (bool, error)                  `pgproc:"tests.test_returns_integer"`
+		WrongField func(id int) (struct{ X int }, error) `pgproc:"tests.content_get"`
+		Hidden     func() (bool, error)                  `pgproc:"tests._hidden_function"`
+		NoSchema   func() error                          `pgproc:"test_returns_integer"`
+		Ok         func() (int, error)                   `pgproc:"tests.test_returns_integer"`
+	}
+	err := Bind(base, &api)
+	if err == nil {
+		t.Fatalf("Error expected binding errors")
+	}
+	for _, field := range []string{"Unknown", "WrongArity", "WrongParam", "WrongRes", "WrongField", "Hidden", "NoSchema"} {
+		if !strings.Contains(err.Error(), field+" (") {
+			t.Errorf("Error expected an error for %s in %s", field, err)
+		}
+	}
+	if api.Ok != nil {
+		t.Errorf("Error expected no field bound on errors")
+	}
+}
+
+func TestBindUnreachable(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost")
+	if err != nil {
+		t.Fatalf("Error opening: %s", err)
+	}
+	db.Close()
+	var api struct {
+		Integer func() (int, error) `pgproc:"tests.test_returns_integer"`
+	}
+	err = Bind(&PgProc{db: db}, &api)
+	if err == nil || strings.Contains(err.Error(), "not found") {
+		t.Errorf("Error expected lookup error: %v", err)
+	}
+	if api.Integer != nil {
+		t.Errorf("Error expected no field bound")
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	if schema, proc, err := splitName("tests.content_add"); err != nil || schema != "tests" || proc != "content_add" {
+		t.Errorf("Error splitting name: %s %s %v", schema, proc, err)
+	}
+	for _, name := range []string{"content_add", ".content_add", "tests."} {
+		if _, _, err := splitName(name); err == nil {
+			t.Errorf("Error expected for %s", name)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package pgproc
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultCacheSize is the default maximum number of results in the cache
+const DefaultCacheSize = 1000
+
+// CacheOptions configures the cache of the results of the calls, see SetCache
+type CacheOptions struct {
+	// Size is the maximum number of results in the cache, the least recently
+	// used ones being evicted, DefaultCacheSize if 0
+	Size int
+	// TTL is the time to live of the results of the IMMUTABLE functions,
+	// no expiry if 0
+	TTL time.Duration
+}
+
+// SetCache enables the in-process cache of the results of the calls:
+// the results of the IMMUTABLE functions, of the functions whose comment
+// (COMMENT ON FUNCTION) contains the @cache annotation, optionally followed
+// by a time to live (@cache ttl=5m), and of the functions enabled
+// with CacheFunction, are cached by function, arguments and result type,
+// and the calls done with the same arguments return copies of them without
+// calling the database, nor looking up the catalog. The results sent to
+// a channel, and the calls done in a transaction or a session, whose
+// results may depend on the role, the settings or the changes of the
+// transaction, are not cached.
+//
+// SetCache must be called before the PgProc is used.
+func (p *PgProc) SetCache(options CacheOptions) {
+	if options.Size <= 0 {
+		options.Size = DefaultCacheSize
+	}
+	p.cache = &resultCache{
+		options: options,
+		ttls:    map[[2]string]time.Duration{},
+		types:   map[lookupKey]typeEntry{},
+		lru:     list.New(),
+		entries: map[cacheKey]*list.Element{},
+	}
+}
+
+// CacheFunction enables the cache of the results of the function proc
+// of schema, for ttl or without expiry if ttl is 0, enabling the cache
+// with the default options if SetCache has not been called.
+//
+// CacheFunction must be called before the PgProc is used.
+func (p *PgProc) CacheFunction(schema string, proc string, ttl time.Duration) {
+	if p.cache == nil {
+		p.SetCache(CacheOptions{})
+	}
+	p.cache.ttls[[2]string{schema, proc}] = ttl
+}
+
+// InvalidateCache removes the results of the function proc of schema
+// from the cache, or all the results if schema and proc are empty
+func (p *PgProc) InvalidateCache(schema string, proc string) {
+	if p.cache != nil {
+		p.cache.invalidate(schema, proc)
+	}
+}
+
+// ListenCacheInvalidations listens to the notifications of channel and
+// invalidates the cache for each of them: the results of the function
+// named in the payload (NOTIFY channel, 'schema.proc'), or all the
+// results for an empty payload or after a lost connection.
+// The listening stops when Close is called.
+func (p *PgProc) ListenCacheInvalidations(channel string) error {
+	if p.cache == nil {
+		return errors.New("cache not enabled")
+	}
+	listener := pq.NewListener(p.conninfo, time.Second, time.Minute, nil)
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return err
+	}
+	p.cache.listeners = append(p.cache.listeners, listener)
+	go func() {
+		for n := range listener.Notify {
+			if n == nil || n.Extra == "" {
+				// notifications may have been lost
+				p.cache.invalidate("", "")
+				continue
+			}
+			schema, proc, err := splitName(n.Extra)
+			if err == nil {
+				p.cache.invalidate(schema, proc)
+			}
+		}
+	}()
+	return nil
+}
+
+// lookupKey identifies the catalog lookup of a function
+type lookupKey struct {
+	schema string
+	proc   string
+	nargs  int
+}
+
+// cacheKey identifies a result in the cache
+type cacheKey struct {
+	schema string
+	proc   string
+	args   string
+	result reflect.Type
+}
+
+// typeEntry is a return type in the cache
+type typeEntry struct {
+	rt      *returnType
+	expires time.Time
+}
+
+// cacheEntry is a result in the cache
+type cacheEntry struct {
+	key     cacheKey
+	value   reflect.Value
+	rows    int
+	expires time.Time
+}
+
+// resultCache is the LRU cache of the results of a PgProc
+type resultCache struct {
+	options   CacheOptions
+	ttls      map[[2]string]time.Duration
+	listeners []*pq.Listener
+
+	mu      sync.Mutex
+	types   map[lookupKey]typeEntry
+	lru     *list.List
+	entries map[cacheKey]*list.Element
+}
+
+// cachedCall is a call whose result is cached
+type cachedCall struct {
+	key cacheKey
+	ttl time.Duration
+	// from is the length of a slice result before the call
+	from int
+}
+
+// lookupReturnType returns the return type of the function proc of schema
+// with nargs arguments, from the cache for a function whose results are
+// cached, for the time to live of its results
+func (p *PgProc) lookupReturnType(ctx context.Context, schema string, proc string, nargs int) (*returnType, error) {
+	if p.cache == nil || uncached(ctx) {
+		return p.getReturnType(ctx, schema, proc, nargs)
+	}
+	key := lookupKey{schema: schema, proc: proc, nargs: nargs}
+	p.cache.mu.Lock()
+	entry, found := p.cache.types[key]
+	p.cache.mu.Unlock()
+	if found && (entry.expires.IsZero() || time.Now().Before(entry.expires)) {
+		return entry.rt, nil
+	}
+	rt, err := p.getReturnType(ctx, schema, proc, nargs)
+	if err != nil {
+		return nil, err
+	}
+	if ttl, cached := p.cache.ttl(schema, proc, rt); cached {
+		entry := typeEntry{rt: rt}
+		if ttl > 0 {
+			entry.expires = time.Now().Add(ttl)
+		}
+		p.cache.mu.Lock()
+		p.cache.types[key] = entry
+		p.cache.mu.Unlock()
+	}
+	return rt, nil
+}
+
+// cachedCall returns the cached call of inv with the encoded params,
+// or nil if its result is not to be cached
+func (p *PgProc) cachedCall(ctx context.Context, inv *Invocation, params []interface{}) *cachedCall {
+	if p.cache == nil || inv.Result == nil {
+		return nil
+	}
+	v := reflect.ValueOf(inv.Result)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
+	ttl, cached := p.cache.ttl(inv.Schema, inv.Proc, inv.rt)
+	if !cached {
+		return nil
+	}
+	if uncached(ctx) {
+		return nil
+	}
+	args, ok := normalizeArgs(params)
+	if !ok {
+		return nil
+	}
+	call := &cachedCall{key: cacheKey{schema: inv.Schema, proc: inv.Proc, args: args, result: v.Type()}, ttl: ttl}
+	if inv.rt.setof && v.Elem().Kind() == reflect.Slice {
+		call.from = v.Elem().Len()
+	}
+	return call
+}
+
+// uncached tells if the calls done with ctx bypass the cache: the calls
+// done in a transaction or a session, as their results may depend on
+// the role, the settings or the changes of the transaction
+func uncached(ctx context.Context) bool {
+	_, inTx := ctx.Value(txKey{}).(*sql.Tx)
+	_, inSession := ctx.Value(sessionKey{}).(*session)
+	return inTx || inSession
+}
+
+// ttl returns the time to live of the results of the function proc
+// of schema, and false if they are not cached
+func (c *resultCache) ttl(schema string, proc string, rt *returnType) (time.Duration, bool) {
+	if ttl, found := c.ttls[[2]string{schema, proc}]; found {
+		return ttl, true
+	}
+	if rt.annotated {
+		return rt.cacheTTL, true
+	}
+	return c.options.TTL, rt.volatility == "i"
+}
+
+// cacheAnnotation returns the time to live given by the @cache annotation
+// of the comment of a function, @cache ttl=1m, no expiry for @cache alone,
+// and false if the comment has no valid annotation
+func cacheAnnotation(comment string) (time.Duration, bool) {
+	fields := strings.Fields(comment)
+	for i, field := range fields {
+		if field != "@cache" {
+			continue
+		}
+		if i+1 < len(fields) && strings.HasPrefix(fields[i+1], "ttl=") {
+			ttl, err := time.ParseDuration(strings.TrimPrefix(fields[i+1], "ttl="))
+			return ttl, err == nil && ttl > 0
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// load stores a copy of the cached result of call into the result of inv,
+// and returns false if the result is not in the cache
+func (c *resultCache) load(call *cachedCall, inv *Invocation) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.entries[call.key]
+	if !found {
+		return false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, call.key)
+		return false
+	}
+	c.lru.MoveToFront(elem)
+	v := reflect.ValueOf(inv.Result).Elem()
+	if inv.rt.setof && v.Kind() == reflect.Slice {
+		v.Set(reflect.AppendSlice(v, copyValue(entry.value)))
+	} else {
+		v.Set(copyValue(entry.value))
+	}
+	inv.Rows = entry.rows
+	return true
+}
+
+// store stores a copy of the result of inv in the cache
+func (c *resultCache) store(call *cachedCall, inv *Invocation) {
+	v := reflect.ValueOf(inv.Result).Elem()
+	if inv.rt.setof && v.Kind() == reflect.Slice {
+		v = v.Slice(call.from, v.Len())
+	}
+	// the value must not refer to the result
+	value := reflect.New(v.Type()).Elem()
+	value.Set(copyValue(v))
+	entry := &cacheEntry{key: call.key, value: value, rows: inv.Rows}
+	if call.ttl > 0 {
+		entry.expires = time.Now().Add(call.ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.entries[call.key]; found {
+		c.lru.Remove(elem)
+	}
+	c.entries[call.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.options.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidate removes the results and the return types of the function
+// proc of schema, or all of them if schema and proc are empty
+func (c *resultCache) invalidate(schema string, proc string) {
+	all := schema == "" && proc == ""
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.types {
+		if all || (key.schema == schema && key.proc == proc) {
+			delete(c.types, key)
+		}
+	}
+	for key, elem := range c.entries {
+		if all || (key.schema == schema && key.proc == proc) {
+			c.lru.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// close stops listening to the invalidations
+func (c *resultCache) close() {
+	for _, listener := range c.listeners {
+		listener.Close()
+	}
+}
+
+// normalizeArgs returns the textual form of the encoded parameters of
+// a call, identifying their values, and false if a parameter cannot be
+// represented
+func normalizeArgs(params []interface{}) (string, bool) {
+	var b strings.Builder
+	for i, param := range params {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if valuer, ok := param.(driver.Valuer); ok {
+			value, err := valuer.Value()
+			if err != nil {
+				return "", false
+			}
+			param = value
+		}
+		v := reflect.ValueOf(param)
+		for v.IsValid() && v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if !v.IsValid() || v.Kind() == reflect.Ptr {
+			b.WriteString("NULL")
+			continue
+		}
+		switch value := v.Interface().(type) {
+		case []byte:
+			b.WriteString("x" + hex.EncodeToString(value))
+			continue
+		case time.Time:
+			b.WriteString("t" + value.Format(time.RFC3339Nano))
+			continue
+		}
+		switch v.Kind() {
+		case reflect.String:
+			b.WriteString(strconv.Quote(v.String()))
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			fmt.Fprintf(&b, "%v", v.Interface())
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// copyValue returns a deep copy of v; the values of the unexported
+// fields of structs are shared, except for big.Int and big.Rat
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		switch x := v.Interface().(type) {
+		case *big.Int:
+			return reflect.ValueOf(new(big.Int).Set(x))
+		case *big.Rat:
+			return reflect.ValueOf(new(big.Rat).Set(x))
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return c
+	}
+	return v
+}
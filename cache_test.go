@@ -0,0 +1,230 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeArgs(t *testing.T) {
+	i := 3
+	var nilPtr *int
+	for _, c := range []struct {
+		params   []interface{}
+		expected string
+	}{
+		{nil, ""},
+		{[]interface{}{1, int64(1), "a,b", nil, nilPtr, &i}, `1,1,"a,b",NULL,NULL,3`},
+		{[]interface{}{[]byte{1, 255}, true, 1.5}, "x01ff,true,1.5"},
+		{[]interface{}{time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)}, "t2024-01-02T03:04:05.000000006Z"},
+	} {
+		if s, ok := normalizeArgs(c.params); !ok || s != c.expected {
+			t.Errorf("Error normalizing %v: %s %v", c.params, s, ok)
+		}
+	}
+	if _, ok := normalizeArgs([]interface{}{struct{ A int }{1}}); ok {
+		t.Errorf("Error expected struct not normalized")
+	}
+}
+
+func TestCopyValue(t *testing.T) {
+	type item struct {
+		Name  string
+		Tags  []string
+		Attrs map[string]*int
+		Value *big.Int
+		Any   interface{}
+	}
+	one := 1
+	v := []item{{Name: "a", Tags: []string{"x"}, Attrs: map[string]*int{"one": &one}, Value: big.NewInt(2), Any: []int{3}}}
+	c := copyValue(reflect.ValueOf(v)).Interface().([]item)
+	if !reflect.DeepEqual(c, v) {
+		t.Fatalf("Error copying: %+v", c)
+	}
+	c[0].Tags[0] = "y"
+	*c[0].Attrs["one"] = 10
+	c[0].Any.([]int)[0] = 30
+	c[0].Value.SetInt64(20)
+	if v[0].Tags[0] != "x" || one != 1 || v[0].Any.([]int)[0] != 3 || v[0].Value.Int64() != 2 {
+		t.Errorf("Error expected deep copy: %+v", v)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	var p PgProc
+	p.SetCache(CacheOptions{Size: 2})
+	p.CacheFunction("tests", "stable", time.Millisecond)
+	immutable := &returnType{scalar: true, scalarType: "int4", volatility: "i"}
+	setof := &returnType{scalar: true, setof: true, scalarType: "int4", volatility: "s"}
+	volatile := &returnType{scalar: true, scalarType: "int4", volatility: "v"}
+
+	var res int
+	inv := &Invocation{Schema: "tests", Proc: "immutable", Result: &res, rt: immutable}
+	if call := p.cachedCall(context.Background(), &Invocation{Schema: "tests", Proc: "volatile", Result: &res, rt: volatile}, nil); call != nil {
+		t.Errorf("Error expected volatile function not cached")
+	}
+	call := p.cachedCall(context.Background(), inv, []interface{}{int64(1)})
+	if call == nil || call.ttl != 0 {
+		t.Fatalf("Error expected immutable function cached without expiry: %+v", call)
+	}
+	if p.cachedCall(WithSession(context.Background(), "reader", nil), inv, []interface{}{int64(1)}) != nil {
+		t.Errorf("Error expected immutable function not cached in a session")
+	}
+	if p.cache.load(call, inv) {
+		t.Errorf("Error expected cache miss")
+	}
+	res, inv.Rows = 42, 1
+	p.cache.store(call, inv)
+	res, inv.Rows = 0, 0
+	if !p.cache.load(call, inv) || res != 42 || inv.Rows != 1 {
+		t.Errorf("Error expected cache hit: %d %d", res, inv.Rows)
+	}
+
+	// SETOF results are appended to the slice
+	list := []int{1}
+	sinv := &Invocation{Schema: "tests", Proc: "stable", Result: &list, rt: setof}
+	scall := p.cachedCall(context.Background(), sinv, nil)
+	if scall == nil || scall.from != 1 || scall.ttl != time.Millisecond {
+		t.Fatalf("Error expected opt-in function cached: %+v", scall)
+	}
+	if p.cachedCall(WithSession(context.Background(), "", nil), sinv, nil) != nil {
+		t.Errorf("Error expected opt-in function not cached in a session")
+	}
+	list, sinv.Rows = append(list, 2, 3), 2
+	p.cache.store(scall, sinv)
+	list = []int{0}
+	if !p.cache.load(scall, sinv) || !reflect.DeepEqual(list, []int{0, 2, 3}) {
+		t.Errorf("Error expected rows appended: %v", list)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if p.cache.load(scall, sinv) {
+		t.Errorf("Error expected expired result")
+	}
+
+	// LRU eviction
+	p.cache.store(scall, sinv)
+	p.cache.load(call, inv)
+	other := p.cachedCall(context.Background(), inv, []interface{}{int64(2)})
+	p.cache.store(other, inv)
+	if p.cache.load(scall, sinv) || !p.cache.load(call, inv) || !p.cache.load(other, inv) {
+		t.Errorf("Error expected least recently used result evicted")
+	}
+
+	p.InvalidateCache("tests", "immutable")
+	if p.cache.load(call, inv) || p.cache.load(other, inv) {
+		t.Errorf("Error expected results invalidated")
+	}
+}
+
+func TestLookupReturnType(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost")
+	if err != nil {
+		t.Fatalf("Error opening: %s", err)
+	}
+	db.Close()
+	p := &PgProc{db: db}
+	p.CacheFunction("tests", "stable", time.Minute)
+	if _, err := p.lookupReturnType(context.Background(), "tests", "stable", 0); err == nil {
+		t.Errorf("Error expected lookup error")
+	}
+	if len(p.cache.types) != 0 {
+		t.Errorf("Error expected failed lookup not cached: %v", p.cache.types)
+	}
+
+	rt := &returnType{scalar: true, scalarType: "int4", volatility: "s"}
+	p.cache.types[lookupKey{schema: "tests", proc: "stable"}] = typeEntry{rt: rt, expires: time.Now().Add(time.Minute)}
+	if res, err := p.lookupReturnType(context.Background(), "tests", "stable", 0); err != nil || res != rt {
+		t.Errorf("Error expected cached return type: %v %v", res, err)
+	}
+	p.cache.types[lookupKey{schema: "tests", proc: "stable"}] = typeEntry{rt: rt, expires: time.Now().Add(-time.Second)}
+	if _, err := p.lookupReturnType(context.Background(), "tests", "stable", 0); err == nil {
+		t.Errorf("Error expected expired return type looked up")
+	}
+}
+
+func TestCacheAnnotation(t *testing.T) {
+	cases := []struct {
+		comment string
+		ttl     time.Duration
+		cached  bool
+	}{
+		{"", 0, false},
+		{"Lists the countries", 0, false},
+		{"Lists the countries @cache", 0, true},
+		{"Lists the countries @cache ttl=5m", 5 * time.Minute, true},
+		{"@cache ttl=soon", 0, false},
+		{"@cached", 0, false},
+	}
+	for _, c := range cases {
+		if ttl, cached := cacheAnnotation(c.comment); ttl != c.ttl || cached != c.cached {
+			t.Errorf("Error annotation of %q: %v %v", c.comment, ttl, cached)
+		}
+	}
+
+	p := &PgProc{}
+	p.SetCache(CacheOptions{TTL: time.Hour})
+	cache := p.cache
+	rt := &returnType{volatility: "s", annotated: true, cacheTTL: time.Minute}
+	if ttl, cached := cache.ttl("tests", "stable", rt); ttl != time.Minute || !cached {
+		t.Errorf("Error expected annotated function cached: %v %v", ttl, cached)
+	}
+	cache.ttls[[2]string{"tests", "stable"}] = 0
+	if ttl, cached := cache.ttl("tests", "stable", rt); ttl != 0 || !cached {
+		t.Errorf("Error expected CacheFunction to override the annotation: %v %v", ttl, cached)
+	}
+}
+
+func TestCacheFunction(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	defer p.Close()
+	p.CacheFunction("tests", "content_add", 0)
+	var tracer recordingTracer
+	p.SetTracer(&tracer)
+
+	var first, second int
+	if err := p.Call(&first, "tests", "content_add", "cached"); err != nil {
+		t.Fatalf("Error calling: %s", err)
+	}
+	if err := p.Call(&second, "tests", "content_add", "cached"); err != nil || second != first {
+		t.Errorf("Error expected cached result: %d %d %v", first, second, err)
+	}
+	if hit := tracer.spans[len(tracer.spans)-1].attributes["pgproc.cache"]; hit != "hit" {
+		t.Errorf("Error expected cache hit: %v", hit)
+	}
+	var third int
+	ctx := WithSession(context.Background(), "", nil)
+	if err := p.CallContext(ctx, &third, "tests", "content_add", "cached"); err != nil || third == first {
+		t.Errorf("Error expected result not cached in a session: %d %d %v", first, third, err)
+	}
+	if err := p.ListenCacheInvalidations("pgproc_cache"); err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	if _, err := p.db.Exec("NOTIFY pgproc_cache, 'tests.content_add'"); err != nil {
+		t.Fatalf("Error notifying: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := p.Call(&second, "tests", "content_add", "cached"); err != nil || second == first {
+		t.Errorf("Error expected invalidated result: %d %d %v", first, second, err)
+	}
+
+	var immutable []int
+	p.Call(&immutable, "tests", "test_returns_setof_integer")
+	immutable = nil
+	if err := p.Call(&immutable, "tests", "test_returns_setof_integer"); err != nil || !reflect.DeepEqual(immutable, []int{42, 43, 44}) {
+		t.Errorf("Error expected cached immutable result: %v %v", immutable, err)
+	}
+
+	var annotated, again int
+	if err := p.Call(&annotated, "tests", "test_annotated_cache"); err != nil {
+		t.Fatalf("Error calling: %s", err)
+	}
+	if err := p.Call(&again, "tests", "test_annotated_cache"); err != nil || again != annotated {
+		t.Errorf("Error expected cached annotated result: %d %d %v", annotated, again, err)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// pgType is a type of the database catalog
+type pgType struct {
+	Oid      int64
+	Schema   string
+	Name     string
+	Kind     byte // b: base, c: composite, d: domain, e: enum, p: pseudo
+	Category byte // A: array
+	Elem     int64
+	Base     int64
+}
+
+// attribute is an attribute of a composite type or a column of a table
+type attribute struct {
+	Name    string
+	Type    int64
+	NotNull bool
+}
+
+// argument is an input argument of a function
+type argument struct {
+	Name string
+	Type int64
+}
+
+// function is a function of the database catalog
+type function struct {
+	Schema     string
+	Name       string
+	Args       []argument
+	Result     int64
+	Setof      bool
+	Variadic   bool
+	HasOutArgs bool
+	Signature  string
+	ResultDef  string
+	Comment    string
+}
+
+// catalog holds the types and the functions read from the database
+type catalog struct {
+	types     map[int64]*pgType
+	functions []*function
+	// composite types, table row types and enum types of the schemas
+	composites []*compositeType
+	enums      []*enumType
+}
+
+// compositeType is a composite type or the row type of a table or view
+type compositeType struct {
+	Type       *pgType
+	Table      bool
+	Attributes []attribute
+}
+
+// enumType is an enum type and its labels
+type enumType struct {
+	Type   *pgType
+	Labels []string
+}
+
+// loadCatalog reads the types of the database and the functions of the schemas
+func loadCatalog(db *sql.DB, schemas []string) (*catalog, error) {
+	c := &catalog{types: map[int64]*pgType{}}
+	if err := c.loadTypes(db); err != nil {
+		return nil, err
+	}
+	for _, schema := range schemas {
+		if err := c.loadFunctions(db, schema); err != nil {
+			return nil, err
+		}
+		if err := c.loadComposites(db, schema); err != nil {
+			return nil, err
+		}
+		if err := c.loadEnums(db, schema); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *catalog) loadTypes(db *sql.DB) error {
+	query := `
+SELECT
+  pg_type.oid,
+  nspname,
+  typname,
+  typtype,
+  typcategory,
+  typelem,
+  typbasetype
+FROM pg_type
+INNER JOIN pg_namespace ON pg_namespace.oid = pg_type.typnamespace`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			t        pgType
+			kind     string
+			category string
+		)
+		if err := rows.Scan(&t.Oid, &t.Schema, &t.Name, &kind, &category, &t.Elem, &t.Base); err != nil {
+			return err
+		}
+		t.Kind, t.Category = kind[0], category[0]
+		c.types[t.Oid] = &t
+	}
+	return rows.Err()
+}
+
+func (c *catalog) loadFunctions(db *sql.DB, schema string) error {
+	query := `
+SELECT
+  proname,
+  proargtypes::oid[],
+  coalesce(proargnames, '{}'),
+  coalesce(proargmodes::text[], '{}'),
+  prorettype,
+  proretset,
+  pg_get_function_identity_arguments(pg_proc.oid),
+  pg_get_function_result(pg_proc.oid),
+  coalesce(obj_description(pg_proc.oid, 'pg_proc'), '')
+FROM pg_proc
+INNER JOIN pg_namespace ON pg_namespace.oid = pg_proc.pronamespace
+WHERE
+  nspname = $1 AND
+  NOT EXISTS (SELECT 1 FROM pg_aggregate WHERE aggfnoid = pg_proc.oid)
+ORDER BY proname, pronargs`
+
+	rows, err := db.Query(query, schema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			f        = function{Schema: schema}
+			argTypes pq.Int64Array
+			argNames pq.StringArray
+			argModes pq.StringArray
+		)
+		err := rows.Scan(&f.Name, &argTypes, &argNames, &argModes, &f.Result, &f.Setof,
+			&f.Signature, &f.ResultDef, &f.Comment)
+		if err != nil {
+			return err
+		}
+		// proargtypes lists the input arguments only,
+		// proargnames and proargmodes list all the arguments
+		var names []string
+		n := len(argModes)
+		if n == 0 {
+			n = len(argNames)
+		}
+		for i := 0; i < n; i++ {
+			mode, name := "i", ""
+			if i < len(argModes) {
+				mode = argModes[i]
+			}
+			if i < len(argNames) {
+				name = argNames[i]
+			}
+			switch mode {
+			case "i", "b":
+				names = append(names, name)
+			case "v":
+				names = append(names, name)
+				f.Variadic = true
+			default:
+				f.HasOutArgs = true
+			}
+		}
+		for i, oid := range argTypes {
+			arg := argument{Type: oid}
+			if i < len(names) {
+				arg.Name = names[i]
+			}
+			f.Args = append(f.Args, arg)
+		}
+		c.functions = append(c.functions, &f)
+	}
+	return rows.Err()
+}
+
+func (c *catalog) loadComposites(db *sql.DB, schema string) error {
+	query := `
+SELECT
+  pg_type.oid,
+  relkind IN ('r', 'p', 'v', 'm', 'f'),
+  attname,
+  atttypid,
+  attnotnull
+FROM pg_type
+INNER JOIN pg_namespace ON pg_namespace.oid = pg_type.typnamespace
+INNER JOIN pg_class ON pg_class.oid = pg_type.typrelid
+INNER JOIN pg_attribute ON pg_attribute.attrelid = pg_type.typrelid
+WHERE
+  nspname = $1 AND
+  typtype = 'c' AND
+  attnum > 0 AND
+  NOT attisdropped
+ORDER BY typname, attnum`
+
+	rows, err := db.Query(query, schema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var current *compositeType
+	for rows.Next() {
+		var (
+			oid   int64
+			table bool
+			attr  attribute
+		)
+		if err := rows.Scan(&oid, &table, &attr.Name, &attr.Type, &attr.NotNull); err != nil {
+			return err
+		}
+		if current == nil || current.Type.Oid != oid {
+			current = &compositeType{Type: c.types[oid], Table: table}
+			c.composites = append(c.composites, current)
+		}
+		current.Attributes = append(current.Attributes, attr)
+	}
+	return rows.Err()
+}
+
+func (c *catalog) loadEnums(db *sql.DB, schema string) error {
+	query := `
+SELECT
+  pg_type.oid,
+  enumlabel
+FROM pg_enum
+INNER JOIN pg_type ON pg_type.oid = pg_enum.enumtypid
+INNER JOIN pg_namespace ON pg_namespace.oid = pg_type.typnamespace
+WHERE
+  nspname = $1
+ORDER BY typname, enumsortorder`
+
+	rows, err := db.Query(query, schema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var current *enumType
+	for rows.Next() {
+		var (
+			oid   int64
+			label string
+		)
+		if err := rows.Scan(&oid, &label); err != nil {
+			return err
+		}
+		if current == nil || current.Type.Oid != oid {
+			current = &enumType{Type: c.types[oid]}
+			c.enums = append(c.enums, current)
+		}
+		current.Labels = append(current.Labels, label)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// goTypes maps PostgreSQL base types to Go types
+var goTypes = map[string]string{
+	"bool":        "bool",
+	"int2":        "int16",
+	"int4":        "int32",
+	"int8":        "int64",
+	"oid":         "int64",
+	"float4":      "float32",
+	"float8":      "float64",
+	"numeric":     "pgproc.Decimal",
+	"text":        "string",
+	"varchar":     "string",
+	"bpchar":      "string",
+	"char":        "string",
+	"name":        "string",
+	"citext":      "string",
+	"bytea":       "[]byte",
+	"date":        "time.Time",
+	"timestamp":   "time.Time",
+	"timestamptz": "time.Time",
+	"time":        "time.Time",
+	"timetz":      "time.Time",
+	"uuid":        "pgproc.UUID",
+	"inet":        "netip.Prefix",
+	"cidr":        "netip.Prefix",
+	"macaddr":     "net.HardwareAddr",
+	"macaddr8":    "net.HardwareAddr",
+	"json":        "json.RawMessage",
+	"jsonb":       "json.RawMessage",
+}
+
+// packages of the qualified Go types
+var goPackages = map[string]string{
+	"pgproc": "github.com/feloy/pgproc",
+	"time":   "time",
+	"netip":  "net/netip",
+	"net":    "net",
+	"json":   "encoding/json",
+	"driver": "database/sql/driver",
+	"fmt":    "fmt",
+}
+
+// generator generates the Go code calling the functions of a catalog
+type generator struct {
+	catalog *catalog
+	pkg     string
+	// types tells if Go types are generated for the composite
+	// and enum types of the schemas
+	types     bool
+	generated map[int64]bool
+	imports   map[string]bool
+	// typeNames are the names of the generated Go types by oid,
+	// names the package-level names already declared, with what
+	// declares them
+	typeNames map[int64]string
+	names     map[string]string
+}
+
+// goType returns the Go type for the PostgreSQL type oid,
+// or an error if the type is not supported
+func (g *generator) goType(oid int64) (string, error) {
+	t, found := g.catalog.types[oid]
+	if !found {
+		return "", fmt.Errorf("unknown type %d", oid)
+	}
+	var goType string
+	switch {
+	case t.Category == 'A' && t.Elem != 0:
+		if elem := g.catalog.types[t.Elem]; elem != nil && elem.Kind == 'c' {
+			return "", fmt.Errorf("arrays of composite type %s are not supported", elem.Name)
+		}
+		elem, err := g.goType(t.Elem)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	case t.Kind == 'd':
+		return g.goType(t.Base)
+	case t.Kind == 'c':
+		if name, found := g.typeNames[oid]; found {
+			return name, nil
+		}
+		if g.types {
+			return "", fmt.Errorf("composite type %s.%s of another schema is not supported", t.Schema, t.Name)
+		}
+		return exportedName(t.Name), nil
+	case t.Kind == 'e':
+		if g.generated[oid] {
+			return g.typeNames[oid], nil
+		}
+		goType = "string"
+	case t.Kind == 'p':
+		return "", fmt.Errorf("pseudo-type %s is not supported", t.Name)
+	default:
+		var found bool
+		if goType, found = goTypes[t.Name]; !found {
+			goType = "string"
+		}
+	}
+	g.use(goType)
+	return goType, nil
+}
+
+// use records the import needed by a qualified Go type
+func (g *generator) use(goType string) {
+	goType = strings.TrimLeft(goType, "[]*")
+	if i := strings.IndexByte(goType, '.'); i > 0 {
+		g.imports[goPackages[goType[:i]]] = true
+	}
+}
+
+// structData is the data given to the template for a composite type
+type structData struct {
+	Name   string
+	Kind   string
+	Def    string
+	Fields []fieldData
+}
+
+type fieldData struct {
+	Name string
+	Type string
+	Tag  string
+}
+
+// enumData is the data given to the template for an enum type
+type enumData struct {
+	Name   string
+	Def    string
+	Values []enumValue
+}
+
+type enumValue struct {
+	Name  string
+	Label string
+}
+
+// ValuesList returns the list of the constants of the enum type
+func (e enumData) ValuesList() string {
+	var names []string
+	for _, v := range e.Values {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// enum returns the data of the Go type of an enum type
+func (g *generator) enum(e *enumType) (enumData, error) {
+	name := g.typeNames[e.Type.Oid]
+	data := enumData{Name: name, Def: e.Type.Schema + "." + e.Type.Name}
+	for _, label := range e.Labels {
+		// labels such as "val 2" and "val2" give the same name
+		value := enumValue{Name: name + exportedName(label), Label: label}
+		if err := g.declare(value.Name, fmt.Sprintf("label %q of %s", label, data.Def)); err != nil {
+			return data, err
+		}
+		data.Values = append(data.Values, value)
+	}
+	g.use("driver.Value")
+	g.use("fmt.Errorf")
+	return data, nil
+}
+
+// composite returns the data of the Go struct of a composite type.
+// Nested composite values are kept in their textual form and
+// the nullable columns of tables are mapped to pointers.
+func (g *generator) composite(c *compositeType) (structData, error) {
+	data := structData{Name: g.typeNames[c.Type.Oid], Kind: "composite type", Def: c.Type.Schema + "." + c.Type.Name}
+	if c.Table {
+		data.Kind = "row type of"
+	}
+	columns := map[string]string{}
+	for _, attr := range c.Attributes {
+		name := exportedName(attr.Name)
+		if column, found := columns[name]; found {
+			return data, fmt.Errorf("columns %q and %q of %s both give the field name %s", column, attr.Name, data.Def, name)
+		}
+		columns[name] = attr.Name
+		goType, err := g.goType(attr.Type)
+		if t := g.catalog.types[attr.Type]; err != nil || (t != nil && t.Kind == 'c') {
+			goType = "string"
+		}
+		nullable := c.Table && !attr.NotNull
+		if nullable && !strings.HasPrefix(goType, "[]") &&
+			goType != "json.RawMessage" && goType != "net.HardwareAddr" {
+			goType = "*" + goType
+		}
+		data.Fields = append(data.Fields, fieldData{
+			Name: name,
+			Type: goType,
+			Tag:  fmt.Sprintf("`pgproc:%q`", attr.Name),
+		})
+	}
+	return data, nil
+}
+
+// apiData is the data given to the template for a schema
+type apiData struct {
+	Schema  string
+	Type    string
+	Methods []methodData
+	Skipped []string
+}
+
+type methodData struct {
+	Name      string
+	Schema    string
+	Proc      string
+	Signature string
+	Comment   []string
+	Params    []paramData
+	Result    string
+	Setof     bool
+}
+
+type paramData struct {
+	Name string
+	Type string
+}
+
+// ParamsDecl returns the declaration of the parameters of the method
+func (m methodData) ParamsDecl() string {
+	decl := "ctx context.Context"
+	for _, p := range m.Params {
+		decl += ", " + p.Name + " " + p.Type
+	}
+	return decl
+}
+
+// ParamsList returns the parameters passed to CallContext
+func (m methodData) ParamsList() string {
+	var list string
+	for _, p := range m.Params {
+		list += ", " + p.Name
+	}
+	return list
+}
+
+// method returns the method calling the function f
+func (g *generator) method(f *function, name string) (methodData, error) {
+	m := methodData{
+		Name:      name,
+		Schema:    f.Schema,
+		Proc:      f.Name,
+		Signature: fmt.Sprintf("%s.%s(%s) RETURNS %s", f.Schema, f.Name, f.Signature, f.ResultDef),
+	}
+	switch {
+	case f.Name[0] == '_':
+		return m, fmt.Errorf("function is not callable")
+	case f.Variadic:
+		return m, fmt.Errorf("variadic functions are not supported")
+	case f.HasOutArgs:
+		return m, fmt.Errorf("functions with OUT arguments are not supported")
+	}
+	if f.Comment != "" {
+		m.Comment = strings.Split(f.Comment, "\n")
+	}
+	used := map[string]bool{"ctx": true, "a": true, "res": true, "err": true}
+	for i, arg := range f.Args {
+		if t := g.catalog.types[arg.Type]; t != nil && t.Kind == 'c' {
+			return m, fmt.Errorf("composite argument %s is not supported", t.Name)
+		}
+		goType, err := g.goType(arg.Type)
+		if err != nil {
+			return m, err
+		}
+		pname := paramName(arg.Name, i)
+		for used[pname] {
+			pname += "Arg"
+		}
+		used[pname] = true
+		m.Params = append(m.Params, paramData{Name: pname, Type: goType})
+	}
+	if t := g.catalog.types[f.Result]; t == nil || t.Kind != 'p' || t.Name != "void" {
+		result, err := g.goType(f.Result)
+		if err != nil {
+			return m, err
+		}
+		m.Result, m.Setof = result, f.Setof
+	}
+	return m, nil
+}
+
+// api returns the data of the API type calling the functions of a schema
+func (g *generator) api(schema string) apiData {
+	api := apiData{Schema: schema, Type: exportedName(schema) + "API"}
+	names := map[string]bool{}
+	arities := map[string]bool{}
+	for _, f := range g.catalog.functions {
+		if f.Schema != schema {
+			continue
+		}
+		// functions are called by name and number of arguments
+		arity := f.Name + "/" + strconv.Itoa(len(f.Args))
+		if arities[arity] {
+			api.Skipped = append(api.Skipped, fmt.Sprintf("%s.%s(%s): ambiguous overloaded function", f.Schema, f.Name, f.Signature))
+			continue
+		}
+		arities[arity] = true
+		name := exportedName(f.Name)
+		if names[name] {
+			name += strconv.Itoa(len(f.Args))
+		}
+		if names[name] {
+			api.Skipped = append(api.Skipped, fmt.Sprintf("%s.%s(%s): method name %s already used", f.Schema, f.Name, f.Signature, name))
+			continue
+		}
+		imports := map[string]bool{}
+		for imp := range g.imports {
+			imports[imp] = true
+		}
+		m, err := g.method(f, name)
+		if err != nil {
+			// forget the imports needed by the skipped function
+			g.imports = imports
+			api.Skipped = append(api.Skipped, fmt.Sprintf("%s.%s(%s): %s", f.Schema, f.Name, f.Signature, err))
+			continue
+		}
+		names[name] = true
+		api.Methods = append(api.Methods, m)
+	}
+	return api
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by pgproc-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+{{range .Structs}}
+// {{.Name}} is the {{.Kind}} {{.Def}}
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} {{.Tag}}
+{{- end}}
+}
+{{end}}
+{{- range $enum := .Enums}}
+// {{.Name}} is the enum type {{.Def}}
+type {{.Name}} string
+
+const (
+{{- range .Values}}
+	{{.Name}} {{$enum.Name}} = {{printf "%q" .Label}}
+{{- end}}
+)
+
+// Valid returns true if e is a label of the enum type {{.Def}}
+func (e {{.Name}}) Valid() bool {
+	switch e {
+	case {{.ValuesList}}:
+		return true
+	}
+	return false
+}
+
+// Scan implements the sql.Scanner interface
+func (e *{{.Name}}) Scan(src interface{}) error {
+	var label string
+	switch s := src.(type) {
+	case []byte:
+		label = string(s)
+	case string:
+		label = s
+	default:
+		return fmt.Errorf("cannot convert %T to {{.Name}}", src)
+	}
+	if !{{.Name}}(label).Valid() {
+		return fmt.Errorf("invalid {{.Name}} value %q", label)
+	}
+	*e = {{.Name}}(label)
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (e {{.Name}}) Value() (driver.Value, error) {
+	if !e.Valid() {
+		return nil, fmt.Errorf("invalid {{.Name}} value %q", string(e))
+	}
+	return string(e), nil
+}
+{{end}}
+{{- range $api := .APIs}}
+// {{.Type}} calls the functions of the {{.Schema}} schema
+type {{.Type}} struct {
+	p *pgproc.PgProc
+}
+
+// New{{.Type}} returns a {{.Type}} calling the functions through p
+func New{{.Type}}(p *pgproc.PgProc) *{{.Type}} {
+	return &{{.Type}}{p: p}
+}
+{{range .Skipped}}
+// Skipped {{.}}
+{{- end}}
+{{range $m := .Methods}}
+// {{.Name}} calls {{.Signature}}
+{{- if .Comment}}
+//
+{{- range .Comment}}
+// {{.}}
+{{- end}}
+{{- end}}
+func (a *{{$api.Type}}) {{.Name}}({{.ParamsDecl}}) {{if .Result}}({{if .Setof}}[]{{end}}{{.Result}}, error){{else}}error{{end}} {
+{{- if .Result}}
+	var res {{if .Setof}}[]{{end}}{{.Result}}
+	err := a.p.CallContext(ctx, &res, "{{.Schema}}", "{{.Proc}}"{{.ParamsList}})
+	return res, err
+{{- else}}
+	return a.p.CallContext(ctx, nil, "{{.Schema}}", "{{.Proc}}"{{.ParamsList}})
+{{- end}}
+}
+{{end}}
+{{- end}}`))
+
+// generate returns the Go source calling the functions of the schemas
+func (g *generator) generate(schemas []string) ([]byte, error) {
+	g.imports = map[string]bool{"github.com/feloy/pgproc": true}
+	g.generated = map[int64]bool{}
+	g.typeNames = map[int64]string{}
+	g.names = map[string]string{}
+	for _, schema := range schemas {
+		api := exportedName(schema) + "API"
+		if err := g.declare(api, "schema "+schema); err != nil {
+			return nil, err
+		}
+		if err := g.declare("New"+api, "schema "+schema); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		structs []structData
+		enums   []enumData
+	)
+	if g.types {
+		if err := g.nameTypes(); err != nil {
+			return nil, err
+		}
+		for _, e := range g.catalog.enums {
+			g.generated[e.Type.Oid] = true
+			data, err := g.enum(e)
+			if err != nil {
+				return nil, err
+			}
+			enums = append(enums, data)
+		}
+		for _, c := range g.catalog.composites {
+			data, err := g.composite(c)
+			if err != nil {
+				return nil, err
+			}
+			structs = append(structs, data)
+		}
+	}
+	var apis []apiData
+	for _, schema := range schemas {
+		api := g.api(schema)
+		if len(api.Methods) > 0 {
+			g.imports["context"] = true
+		}
+		apis = append(apis, api)
+	}
+	var imports []string
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, struct {
+		Package string
+		Imports []string
+		Structs []structData
+		Enums   []enumData
+		APIs    []apiData
+	}{g.pkg, imports, structs, enums, apis})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// nameTypes names the Go types generated for the composite and enum types:
+// the types with the same name in several schemas, or with the name of
+// an API type, are prefixed with their schema
+func (g *generator) nameTypes() error {
+	var types []*pgType
+	for _, e := range g.catalog.enums {
+		types = append(types, e.Type)
+	}
+	for _, c := range g.catalog.composites {
+		types = append(types, c.Type)
+	}
+	count := map[string]int{}
+	for _, t := range types {
+		count[exportedName(t.Name)]++
+	}
+	for _, t := range types {
+		name := exportedName(t.Name)
+		if _, declared := g.names[name]; count[name] > 1 || declared {
+			name = exportedName(t.Schema) + name
+		}
+		if err := g.declare(name, "type "+t.Schema+"."+t.Name); err != nil {
+			return err
+		}
+		g.typeNames[t.Oid] = name
+	}
+	return nil
+}
+
+// declare declares the package-level name for what, or returns an error
+// if name is already declared
+func (g *generator) declare(name string, what string) error {
+	if previous, found := g.names[name]; found {
+		return fmt.Errorf("%s and %s both give the Go name %s", previous, what, name)
+	}
+	g.names[name] = what
+	return nil
+}
+
+// exportedName returns the exported Go name of a PostgreSQL identifier:
+// content_get gives ContentGet
+func exportedName(name string) string {
+	var res string
+	for _, part := range strings.FieldsFunc(name, isNotNameRune) {
+		r, size := utf8.DecodeRuneInString(part)
+		res += string(unicode.ToUpper(r)) + part[size:]
+	}
+	if res == "" || !token.IsIdentifier(res) {
+		res = "X" + res
+	}
+	return res
+}
+
+// paramName returns the Go name of the i-th argument of a function:
+// prm_id gives prmId
+func paramName(name string, i int) string {
+	if name == "" {
+		return "arg" + strconv.Itoa(i+1)
+	}
+	res := exportedName(name)
+	r, size := utf8.DecodeRuneInString(res)
+	res = string(unicode.ToLower(r)) + res[size:]
+	if token.IsKeyword(res) {
+		res += "Arg"
+	}
+	return res
+}
+
+// isNotNameRune returns true for the runes separating the words of an identifier
+func isNotNameRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
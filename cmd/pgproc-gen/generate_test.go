@@ -0,0 +1,254 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testCatalog returns a catalog with some types and functions of tests.sql
+func testCatalog() *catalog {
+	c := &catalog{types: map[int64]*pgType{}}
+	for _, t := range []pgType{
+		{Oid: 16, Schema: "pg_catalog", Name: "bool", Kind: 'b'},
+		{Oid: 23, Schema: "pg_catalog", Name: "int4", Kind: 'b'},
+		{Oid: 25, Schema: "pg_catalog", Name: "text", Kind: 'b'},
+		{Oid: 1082, Schema: "pg_catalog", Name: "date", Kind: 'b'},
+		{Oid: 1007, Schema: "pg_catalog", Name: "_int4", Kind: 'b', Category: 'A', Elem: 23},
+		{Oid: 2249, Schema: "pg_catalog", Name: "record", Kind: 'p'},
+		{Oid: 2278, Schema: "pg_catalog", Name: "void", Kind: 'p'},
+		{Oid: 90001, Schema: "tests", Name: "content", Kind: 'c'},
+		{Oid: 90002, Schema: "tests", Name: "enumtype", Kind: 'e'},
+	} {
+		t := t
+		c.types[t.Oid] = &t
+	}
+	c.functions = []*function{
+		{Schema: "tests", Name: "_hidden_function", Result: 16, Signature: "", ResultDef: "boolean"},
+		{Schema: "tests", Name: "content_add", Args: []argument{{"prm_name", 25}}, Result: 23,
+			Signature: "prm_name text", ResultDef: "integer", Comment: "Adds a content\nand returns its id"},
+		{Schema: "tests", Name: "content_get", Args: []argument{{"prm_id", 23}}, Result: 90001,
+			Signature: "prm_id integer", ResultDef: "tests.content"},
+		{Schema: "tests", Name: "content_list", Result: 90001, Setof: true,
+			ResultDef: "SETOF tests.content"},
+		{Schema: "tests", Name: "content_touch", Args: []argument{{"", 1082}, {"type", 1007}}, Result: 2278,
+			Signature: "date, type integer[]", ResultDef: "void"},
+		{Schema: "tests", Name: "test_enum_arg", Args: []argument{{"enumval", 90002}}, Result: 90002,
+			Signature: "enumval tests.enumtype", ResultDef: "tests.enumtype"},
+		{Schema: "tests", Name: "test_returns_record", Result: 2249, ResultDef: "record"},
+	}
+	c.composites = []*compositeType{
+		{Type: c.types[90001], Table: true, Attributes: []attribute{
+			{Name: "cnt_id", Type: 23, NotNull: true},
+			{Name: "cnt_name", Type: 25},
+			{Name: "cnt_tags", Type: 1007},
+		}},
+	}
+	c.enums = []*enumType{
+		{Type: c.types[90002], Labels: []string{"val1", "val 2"}},
+	}
+	return c
+}
+
+func TestExportedName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"content_get": "ContentGet",
+		"tests":       "Tests",
+		"a__b":        "AB",
+		"1st":         "X1st",
+		"été":         "Été",
+		"+1":          "X1",
+	} {
+		if res := exportedName(name); res != expected {
+			t.Errorf("Error expected %s value is %s", expected, res)
+		}
+	}
+}
+
+func TestParamName(t *testing.T) {
+	if res := paramName("prm_id", 0); res != "prmId" {
+		t.Errorf("Error expected prmId value is %s", res)
+	}
+	if res := paramName("", 2); res != "arg3" {
+		t.Errorf("Error expected arg3 value is %s", res)
+	}
+	if res := paramName("type", 0); res != "typeArg" {
+		t.Errorf("Error expected typeArg value is %s", res)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	g := generator{catalog: testCatalog(), pkg: "api", types: false}
+	src, err := g.generate([]string{"tests"})
+	if err != nil {
+		t.Fatalf("Error generating: %s", err)
+	}
+	code := string(src)
+	for _, expected := range []string{
+		"package api",
+		`"time"`,
+		"type TestsAPI struct",
+		"func NewTestsAPI(p *pgproc.PgProc) *TestsAPI",
+		"// Adds a content\n// and returns its id\n",
+		"func (a *TestsAPI) ContentAdd(ctx context.Context, prmName string) (int32, error)",
+		"func (a *TestsAPI) ContentGet(ctx context.Context, prmId int32) (Content, error)",
+		`err := a.p.CallContext(ctx, &res, "tests", "content_get", prmId)`,
+		"func (a *TestsAPI) ContentList(ctx context.Context) ([]Content, error)",
+		"func (a *TestsAPI) ContentTouch(ctx context.Context, arg1 time.Time, typeArg []int32) error",
+		"func (a *TestsAPI) TestEnumArg(ctx context.Context, enumval string) (string, error)",
+		"// Skipped tests._hidden_function(): function is not callable",
+		"// Skipped tests.test_returns_record(): pseudo-type record is not supported",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Error expected %q in generated code:\n%s", expected, code)
+		}
+	}
+}
+
+func TestGenerateTypes(t *testing.T) {
+	g := generator{catalog: testCatalog(), pkg: "api", types: true}
+	src, err := g.generate([]string{"tests"})
+	if err != nil {
+		t.Fatalf("Error generating: %s", err)
+	}
+	code := string(src)
+	for _, expected := range []string{
+		`"database/sql/driver"`,
+		"// Content is the row type of tests.content\ntype Content struct {",
+		"CntId   int32   `pgproc:\"cnt_id\"`",
+		"CntName *string `pgproc:\"cnt_name\"`",
+		"CntTags []int32 `pgproc:\"cnt_tags\"`",
+		"type Enumtype string",
+		`EnumtypeVal1 Enumtype = "val1"`,
+		`EnumtypeVal2 Enumtype = "val 2"`,
+		"case EnumtypeVal1, EnumtypeVal2:",
+		"func (e *Enumtype) Scan(src interface{}) error",
+		"func (e Enumtype) Value() (driver.Value, error)",
+		"func (a *TestsAPI) TestEnumArg(ctx context.Context, enumval Enumtype) (Enumtype, error)",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Error expected %q in generated code:\n%s", expected, code)
+		}
+	}
+	compile(t, src)
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	c := testCatalog()
+	old := c.snapshot([]string{"tests"})
+	if old.Functions["tests.content_touch(date, _int4)"] != "(date, type integer[]) void" {
+		t.Errorf("Error in snapshot: %v", old.Functions)
+	}
+	if old.Types["tests.enumtype"] != `ENUM ["val1" "val 2"]` {
+		t.Errorf("Error in snapshot: %v", old.Types)
+	}
+	if diffs := c.snapshot([]string{"tests"}).diff(old); len(diffs) != 0 {
+		t.Errorf("Error expected no differences: %v", diffs)
+	}
+
+	c.functions = c.functions[1:]
+	c.functions[0].ResultDef = "bigint"
+	c.functions = append(c.functions, &function{Schema: "tests", Name: "content_count", Result: 23, ResultDef: "integer"})
+	c.enums[0].Labels = append(c.enums[0].Labels, "val3")
+	expected := []string{
+		"- function tests._hidden_function()",
+		"~ function tests.content_add(text): (prm_name text) integer => (prm_name text) bigint",
+		"+ function tests.content_count()",
+		`~ type tests.enumtype: ENUM ["val1" "val 2"] => ENUM ["val1" "val 2" "val3"]`,
+	}
+	diffs := c.snapshot([]string{"tests"}).diff(old)
+	if strings.Join(diffs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Error in differences:\n%s", strings.Join(diffs, "\n"))
+	}
+}
+
+func TestGenerateCollidingNames(t *testing.T) {
+	c := testCatalog()
+	for _, typ := range []pgType{
+		{Oid: 90003, Schema: "other", Name: "content", Kind: 'c'},
+		{Oid: 90004, Schema: "tests", Name: "testsAPI", Kind: 'c'},
+	} {
+		typ := typ
+		c.types[typ.Oid] = &typ
+		c.composites = append(c.composites, &compositeType{Type: c.types[typ.Oid], Attributes: []attribute{{Name: "a", Type: 23}}})
+	}
+	c.functions = append(c.functions,
+		&function{Schema: "tests", Name: "content_get1", Result: 90001, ResultDef: "tests.content"},
+		&function{Schema: "tests", Name: "contentGet", Args: []argument{{"prm_id", 23}}, Result: 23,
+			Signature: "prm_id integer", ResultDef: "integer"})
+	g := generator{catalog: c, pkg: "api", types: true}
+	src, err := g.generate([]string{"tests"})
+	if err != nil {
+		t.Fatalf("Error generating: %s", err)
+	}
+	code := string(src)
+	for _, expected := range []string{
+		"type TestsContent struct {",
+		"type OtherContent struct {",
+		"type TestsTestsAPI struct {",
+		"type TestsAPI struct {",
+		"func (a *TestsAPI) ContentGet(ctx context.Context, prmId int32) (TestsContent, error)",
+		"// Skipped tests.contentGet(prm_id integer): method name ContentGet1 already used",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Error expected %q in generated code:\n%s", expected, code)
+		}
+	}
+	compile(t, src)
+}
+
+func TestGenerateCollidingLabels(t *testing.T) {
+	c := testCatalog()
+	c.enums[0].Labels = append(c.enums[0].Labels, "val2")
+	g := generator{catalog: c, pkg: "api", types: true}
+	_, err := g.generate([]string{"tests"})
+	if err == nil || err.Error() != `label "val 2" of tests.enumtype and label "val2" of tests.enumtype both give the Go name EnumtypeVal2` {
+		t.Errorf("Error expected colliding labels: %v", err)
+	}
+}
+
+func TestGenerateCollidingColumns(t *testing.T) {
+	c := testCatalog()
+	c.composites[0].Attributes = append(c.composites[0].Attributes, attribute{Name: "cntId", Type: 23})
+	g := generator{catalog: c, pkg: "api", types: true}
+	_, err := g.generate([]string{"tests"})
+	if err == nil || err.Error() != `columns "cnt_id" and "cntId" of tests.content both give the field name CntId` {
+		t.Errorf("Error expected colliding columns: %v", err)
+	}
+}
+
+func TestGenerateOtherSchemaType(t *testing.T) {
+	c := testCatalog()
+	c.types[90003] = &pgType{Oid: 90003, Schema: "other", Name: "item", Kind: 'c'}
+	c.functions = append(c.functions, &function{Schema: "tests", Name: "item_get", Result: 90003, ResultDef: "other.item"})
+	g := generator{catalog: c, pkg: "api", types: true}
+	src, err := g.generate([]string{"tests"})
+	if err != nil {
+		t.Fatalf("Error generating: %s", err)
+	}
+	if expected := "// Skipped tests.item_get(): composite type other.item of another schema is not supported"; !strings.Contains(string(src), expected) {
+		t.Errorf("Error expected %q in generated code:\n%s", expected, src)
+	}
+	compile(t, src)
+}
+
+// compile builds the generated code src as a package of the module
+func compile(t *testing.T, src []byte) {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := os.MkdirTemp(".", "generated")
+	if err != nil {
+		t.Fatalf("Error creating package: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "api.go"), src, 0o644); err != nil {
+		t.Fatalf("Error writing package: %s", err)
+	}
+	if out, err := exec.Command("go", "build", "./"+filepath.Base(dir)).CombinedOutput(); err != nil {
+		t.Errorf("Error compiling generated code: %s\n%s\n%s", err, out, src)
+	}
+}
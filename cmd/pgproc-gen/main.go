@@ -0,0 +1,196 @@
+// Command pgproc-gen generates typed Go wrappers calling the functions
+// of PostgreSQL schemas through pgproc.
+//
+// Usage:
+//
+//	pgproc-gen -conninfo "dbname=mydb" -schema tests -package api -o tests_api.go
+//
+// or, from a Go source file, with the connection string in the
+// PGPROC_CONNINFO environment variable:
+//
+//	//go:generate pgproc-gen -schema tests -o tests_api.go
+//
+// For each schema, a type named after the schema (TestsAPI for tests) is
+// generated, with one method per function, as well as Go structs for the
+// composite types and the row types of the tables (Content for tests.content),
+// and string types with constants for the enum types of the schema.
+// With -types=false, the composite types used as results are expected to be
+// declared in the package, named after the type.
+//
+// With -snapshot, the signatures of the functions and the definitions of
+// the types are also saved in a JSON file, and the check command compares
+// this snapshot with the database, listing the added (+), removed (-) and
+// changed (~) functions and types, and exits with status 1 on differences:
+//
+//	pgproc-gen -schema tests -o tests_api.go -snapshot tests_api.json
+//	pgproc-gen check -snapshot tests_api.json
+//
+// The openapi command writes the OpenAPI document of the functions exposed
+// by the HTTP gateway of the httpapi package:
+//
+//	pgproc-gen openapi -schema tests -o openapi.json
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/feloy/pgproc"
+	"github.com/feloy/pgproc/httpapi"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(check(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		os.Exit(openapi(os.Args[2:]))
+	}
+	var (
+		conninfo = flag.String("conninfo", os.Getenv("PGPROC_CONNINFO"), "connection string to the database (default $PGPROC_CONNINFO)")
+		schemas  = flag.String("schema", "", "comma-separated list of schemas")
+		pkg      = flag.String("package", os.Getenv("GOPACKAGE"), "package of the generated file (default $GOPACKAGE)")
+		output   = flag.String("o", "", "output file (default <schema>_pgproc.go, - for the standard output)")
+		types    = flag.Bool("types", true, "generate Go types for the composite, table and enum types of the schemas")
+		snap     = flag.String("snapshot", "", "JSON file to save the signatures of the functions and types into")
+	)
+	flag.Parse()
+	if *schemas == "" {
+		fmt.Fprintln(os.Stderr, "pgproc-gen: -schema is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *pkg == "" {
+		*pkg = "main"
+	}
+	list := strings.Split(*schemas, ",")
+	if *output == "" {
+		*output = list[0] + "_pgproc.go"
+	}
+	if err := run(*conninfo, list, *pkg, *types, *output, *snap); err != nil {
+		fmt.Fprintln(os.Stderr, "pgproc-gen:", err)
+		os.Exit(1)
+	}
+}
+
+// check compares a snapshot with the database, and returns the exit status
+func check(args []string) int {
+	flags := flag.NewFlagSet("pgproc-gen check", flag.ExitOnError)
+	var (
+		conninfo = flags.String("conninfo", os.Getenv("PGPROC_CONNINFO"), "connection string to the database (default $PGPROC_CONNINFO)")
+		snap     = flags.String("snapshot", "", "JSON file written by pgproc-gen -snapshot")
+	)
+	flags.Parse(args)
+	if *snap == "" {
+		fmt.Fprintln(os.Stderr, "pgproc-gen check: -snapshot is required")
+		flags.Usage()
+		return 2
+	}
+	diffs, err := drift(*conninfo, *snap)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pgproc-gen check:", err)
+		return 1
+	}
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+	if len(diffs) > 0 {
+		fmt.Fprintf(os.Stderr, "pgproc-gen check: %d differences with %s\n", len(diffs), *snap)
+		return 1
+	}
+	return 0
+}
+
+// openapi writes the OpenAPI document of the functions of schemas,
+// and returns the exit status
+func openapi(args []string) int {
+	flags := flag.NewFlagSet("pgproc-gen openapi", flag.ExitOnError)
+	var (
+		conninfo = flags.String("conninfo", os.Getenv("PGPROC_CONNINFO"), "connection string to the database (default $PGPROC_CONNINFO)")
+		schemas  = flags.String("schema", "", "comma-separated list of schemas")
+		output   = flags.String("o", "-", "output file (- for the standard output)")
+	)
+	flags.Parse(args)
+	if *schemas == "" {
+		fmt.Fprintln(os.Stderr, "pgproc-gen openapi: -schema is required")
+		flags.Usage()
+		return 2
+	}
+	if err := writeOpenAPI(*conninfo, strings.Split(*schemas, ","), *output); err != nil {
+		fmt.Fprintln(os.Stderr, "pgproc-gen openapi:", err)
+		return 1
+	}
+	return 0
+}
+
+// writeOpenAPI writes the OpenAPI document of the functions of schemas
+// into the file output
+func writeOpenAPI(conninfo string, schemas []string, output string) error {
+	p, err := pgproc.NewPgProc(conninfo)
+	if err != nil {
+		return err
+	}
+	doc, err := httpapi.OpenAPI(context.Background(), p, schemas...)
+	if err != nil {
+		return err
+	}
+	doc = append(doc, '\n')
+	if output == "-" {
+		_, err = os.Stdout.Write(doc)
+		return err
+	}
+	return os.WriteFile(output, doc, 0644)
+}
+
+// drift returns the differences between the snapshot file snap
+// and the functions and types of the database
+func drift(conninfo string, snap string) ([]string, error) {
+	old, err := readSnapshot(snap)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", conninfo)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	c, err := loadCatalog(db, old.Schemas)
+	if err != nil {
+		return nil, err
+	}
+	return c.snapshot(old.Schemas).diff(old), nil
+}
+
+// run generates the file output for the functions (and types) of the schemas,
+// and saves their snapshot into the file snap if not empty
+func run(conninfo string, schemas []string, pkg string, types bool, output string, snap string) error {
+	db, err := sql.Open("postgres", conninfo)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	c, err := loadCatalog(db, schemas)
+	if err != nil {
+		return err
+	}
+	g := generator{catalog: c, pkg: pkg, types: types}
+	src, err := g.generate(schemas)
+	if err != nil {
+		return err
+	}
+	if snap != "" {
+		if err := c.snapshot(schemas).write(snap); err != nil {
+			return err
+		}
+	}
+	if output == "-" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(output, src, 0644)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// snapshot is the description of the functions and types of some schemas,
+// saved as JSON next to the generated code to detect schema drift
+type snapshot struct {
+	Schemas []string `json:"schemas"`
+	// functions, by name and argument types, with their signature and result
+	Functions map[string]string `json:"functions"`
+	// composite and enum types, by name, with their attributes or labels
+	Types map[string]string `json:"types"`
+}
+
+// typeName returns the name of the PostgreSQL type oid,
+// qualified by its schema if not in pg_catalog
+func (c *catalog) typeName(oid int64) string {
+	t, found := c.types[oid]
+	if !found {
+		return fmt.Sprint(oid)
+	}
+	if t.Schema == "pg_catalog" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// snapshot returns the snapshot of the catalog
+func (c *catalog) snapshot(schemas []string) *snapshot {
+	s := &snapshot{Schemas: schemas, Functions: map[string]string{}, Types: map[string]string{}}
+	for _, f := range c.functions {
+		var types []string
+		for _, arg := range f.Args {
+			types = append(types, c.typeName(arg.Type))
+		}
+		key := fmt.Sprintf("%s.%s(%s)", f.Schema, f.Name, strings.Join(types, ", "))
+		s.Functions[key] = fmt.Sprintf("(%s) %s", f.Signature, f.ResultDef)
+	}
+	for _, ct := range c.composites {
+		var attrs []string
+		for _, attr := range ct.Attributes {
+			def := attr.Name + " " + c.typeName(attr.Type)
+			if attr.NotNull {
+				def += " NOT NULL"
+			}
+			attrs = append(attrs, def)
+		}
+		s.Types[c.typeName(ct.Type.Oid)] = "(" + strings.Join(attrs, ", ") + ")"
+	}
+	for _, e := range c.enums {
+		s.Types[c.typeName(e.Type.Oid)] = fmt.Sprintf("ENUM %q", e.Labels)
+	}
+	return s
+}
+
+// diff returns the functions and types added, removed or changed in s
+// since old, one per line prefixed with +, - or ~
+func (s *snapshot) diff(old *snapshot) []string {
+	var diffs []string
+	for _, kind := range []struct {
+		name     string
+		old, new map[string]string
+	}{
+		{"function", old.Functions, s.Functions},
+		{"type", old.Types, s.Types},
+	} {
+		for _, key := range sortedKeys(kind.old) {
+			def, found := kind.new[key]
+			switch {
+			case !found:
+				diffs = append(diffs, fmt.Sprintf("- %s %s", kind.name, key))
+			case def != kind.old[key]:
+				diffs = append(diffs, fmt.Sprintf("~ %s %s: %s => %s", kind.name, key, kind.old[key], def))
+			}
+		}
+		for _, key := range sortedKeys(kind.new) {
+			if _, found := kind.old[key]; !found {
+				diffs = append(diffs, fmt.Sprintf("+ %s %s", kind.name, key))
+			}
+		}
+	}
+	return diffs
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readSnapshot reads a snapshot from the JSON file filename
+func readSnapshot(filename string) (*snapshot, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return &s, nil
+}
+
+// write writes the snapshot as JSON into the file filename
+func (s *snapshot) write(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/feloy/pgproc"
+)
+
+// null is the argument standing for NULL
+const null = `\N`
+
+// call runs the call command, and returns the exit status
+func call(p *pgproc.PgProc, args []string) int {
+	flags := flag.NewFlagSet("pgproc call", flag.ExitOnError)
+	format := flags.String("format", "table", "output format: json, table or csv")
+	positional := parseInterspersed(flags, args)
+	if len(positional) == 0 {
+		fmt.Fprintln(os.Stderr, "pgproc call: missing procedure name")
+		flags.Usage()
+		return 2
+	}
+	out, found := formats[*format]
+	if !found {
+		fmt.Fprintf(os.Stderr, "pgproc call: unknown format %s\n", *format)
+		return 2
+	}
+	res, err := callProc(context.Background(), p, positional[0], positional[1:])
+	if err == nil {
+		err = out(os.Stdout, res)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pgproc call:", err)
+		return 1
+	}
+	return 0
+}
+
+// parseInterspersed parses the flags found among args, before --,
+// and returns the other arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+	var positional []string
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return append(positional, rest...)
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// result holds the result of a call, as text values
+type result struct {
+	types   []string
+	columns []string
+	rows    [][]*string
+	// setof tells if the procedure returns a set of rows
+	setof bool
+	// composite tells if the rows are composite values
+	composite bool
+}
+
+// callProc calls the procedure name (schema.proc) with the textual arguments args
+func callProc(ctx context.Context, p *pgproc.PgProc, name string, args []string) (*result, error) {
+	i := strings.IndexByte(name, '.')
+	if i <= 0 {
+		return nil, fmt.Errorf("'%s' is not a schema-qualified procedure name", name)
+	}
+	schema, proc := name[:i], name[i+1:]
+	functions, err := p.DescribeContext(ctx, schema, proc)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := selectFunction(functions, len(args))
+	if err != nil {
+		return nil, err
+	}
+	args = namedArgs(fn.InArgs(), args)
+	params, err := convertArgs(fn.InArgs(), args)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &result{setof: fn.Result.Setof}
+	if fn.Result.Type == "void" {
+		return res, p.CallContext(ctx, nil, schema, proc, params...)
+	}
+	res.composite = len(fn.Result.Fields) > 0
+	if res.composite {
+		for _, field := range fn.Result.Fields {
+			res.columns = append(res.columns, field.Name)
+			res.types = append(res.types, field.Type)
+		}
+	} else {
+		res.columns, res.types = []string{proc}, []string{fn.Result.Type}
+	}
+	t := textType
+	if res.composite {
+		t = rowType(res.columns)
+	}
+	if fn.Result.Type == "json" && !fn.Result.Setof {
+		// pgproc decodes json results unless stored into a string
+		var text string
+		if err := p.CallContext(ctx, &text, schema, proc, params...); err != nil {
+			return nil, err
+		}
+		res.rows = [][]*string{{&text}}
+		return res, nil
+	}
+	var dest reflect.Value
+	if fn.Result.Setof {
+		dest = reflect.New(reflect.SliceOf(t))
+	} else {
+		dest = reflect.New(t)
+	}
+	if err := p.CallContext(ctx, dest.Interface(), schema, proc, params...); err != nil {
+		return nil, err
+	}
+	values := dest.Elem()
+	if !fn.Result.Setof {
+		values = reflect.Append(reflect.MakeSlice(reflect.SliceOf(t), 0, 1), values)
+	}
+	for i := 0; i < values.Len(); i++ {
+		res.rows = append(res.rows, rowOf(values.Index(i), res.composite))
+	}
+	return res, nil
+}
+
+var textType = reflect.TypeOf((*string)(nil))
+
+// rowType returns a struct type storing the nullable text values of the
+// attributes of a composite type or of the OUT arguments, found by pgproc
+// by name or by tag
+func rowType(columns []string) reflect.Type {
+	var (
+		fields []reflect.StructField
+		names  = map[string]bool{}
+	)
+	for i, column := range columns {
+		name := strings.Title(column)
+		if !token.IsIdentifier(name) || !token.IsExported(name) || names[name] {
+			name = fmt.Sprintf("Column%d", i)
+		}
+		for names[name] {
+			name += "_"
+		}
+		names[name] = true
+		fields = append(fields, reflect.StructField{
+			Name: name,
+			Type: textType,
+			Tag:  reflect.StructTag(fmt.Sprintf("pgproc:%q", column)),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+// rowOf returns the text values of a result value v
+func rowOf(v reflect.Value, composite bool) []*string {
+	if !composite {
+		return []*string{v.Interface().(*string)}
+	}
+	row := make([]*string, v.NumField())
+	for i := range row {
+		row[i] = v.Field(i).Interface().(*string)
+	}
+	return row
+}
+
+// selectFunction returns the overload with nargs input arguments
+func selectFunction(functions []pgproc.Function, nargs int) (pgproc.Function, error) {
+	var counts []string
+	for _, fn := range functions {
+		if fn.Accepts(nargs) {
+			return fn, nil
+		}
+		counts = append(counts, strconv.Itoa(len(fn.InArgs())))
+	}
+	return pgproc.Function{}, fmt.Errorf("%s.%s expects %s arguments, not %d",
+		functions[0].Schema, functions[0].Name, strings.Join(counts, " or "), nargs)
+}
+
+// namedArgs returns the arguments in the order of the arguments of the
+// procedure when all of them are given as name=value, args otherwise
+func namedArgs(in []pgproc.Argument, args []string) []string {
+	values := map[string]string{}
+	for _, arg := range args {
+		i := strings.IndexByte(arg, '=')
+		if i <= 0 {
+			return args
+		}
+		values[arg[:i]] = arg[i+1:]
+	}
+	ordered := make([]string, len(in))
+	for i, arg := range in {
+		value, found := values[arg.Name]
+		if !found {
+			return args
+		}
+		ordered[i] = value
+	}
+	return ordered
+}
+
+// convertArgs converts the textual arguments to the types of the
+// arguments of the procedure
+func convertArgs(in []pgproc.Argument, args []string) ([]interface{}, error) {
+	params := make([]interface{}, len(args))
+	for i, arg := range args {
+		param, err := convertArg(arg, in[i].Type)
+		if err != nil {
+			name := in[i].Name
+			if name == "" {
+				name = strconv.Itoa(i + 1)
+			}
+			return nil, fmt.Errorf("argument %s: %s", name, err)
+		}
+		params[i] = param
+	}
+	return params, nil
+}
+
+// convertArg converts a textual argument to a value of the PostgreSQL type
+// typname; the values of other types are sent as text, for PostgreSQL
+// to convert them
+func convertArg(arg string, typname string) (interface{}, error) {
+	if arg == null {
+		return nil, nil
+	}
+	var (
+		v   interface{}
+		err error
+	)
+	switch typname {
+	case "bool":
+		v, err = strconv.ParseBool(arg)
+	case "int2":
+		v, err = strconv.ParseInt(arg, 10, 16)
+	case "int4":
+		v, err = strconv.ParseInt(arg, 10, 32)
+	case "int8", "oid":
+		v, err = strconv.ParseInt(arg, 10, 64)
+	case "float4", "float8":
+		v, err = strconv.ParseFloat(arg, 64)
+	default:
+		return arg, nil
+	}
+	if err != nil {
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) {
+			err = numErr.Err
+		}
+		return nil, fmt.Errorf("invalid %s value %q: %s", typname, arg, err)
+	}
+	return v, nil
+}
+
+// formats are the functions writing results
+var formats = map[string]func(io.Writer, *result) error{
+	"json":  writeJSON,
+	"table": writeTable,
+	"csv":   writeCSV,
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/feloy/pgproc"
+)
+
+const conninfo = "user=pgproctest password=pgproctest host=localhost dbname=pgproctest sslmode=disable"
+
+func TestParseInterspersed(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	format := flags.String("format", "table", "")
+	args := parseInterspersed(flags, []string{"tests.f", "1", "-format", "json", "2", "--", "-3", "-format"})
+	if *format != "json" || strings.Join(args, " ") != "tests.f 1 2 -3 -format" {
+		t.Errorf("Error parsing: %s %v", *format, args)
+	}
+}
+
+func TestConvertArg(t *testing.T) {
+	for _, c := range []struct {
+		arg, typname string
+		expected     interface{}
+	}{
+		{"3", "int4", int64(3)},
+		{"true", "bool", true},
+		{"1.5", "float8", 1.5},
+		{`\N`, "int4", nil},
+		{"2020-01-01", "date", "2020-01-01"},
+		{"{1,2}", "_int4", "{1,2}"},
+	} {
+		v, err := convertArg(c.arg, c.typname)
+		if err != nil || !reflect.DeepEqual(v, c.expected) {
+			t.Errorf("Error converting %s to %s: %#v %v", c.arg, c.typname, v, err)
+		}
+	}
+	for arg, typname := range map[string]string{"a": "int4", "99999": "int2", "yes": "bool"} {
+		if _, err := convertArg(arg, typname); err == nil {
+			t.Errorf("Error expected converting %s to %s", arg, typname)
+		}
+	}
+}
+
+func TestSelectFunction(t *testing.T) {
+	functions := []pgproc.Function{
+		{Schema: "tests", Name: "f"},
+		{Schema: "tests", Name: "f", Args: []pgproc.Argument{{Name: "a", Mode: "in"}, {Name: "b", Mode: "out"}}},
+	}
+	if fn, err := selectFunction(functions, 1); err != nil || len(fn.Args) != 2 {
+		t.Errorf("Error selecting function: %v", err)
+	}
+	if _, err := selectFunction(functions, 2); err == nil || err.Error() != "tests.f expects 0 or 1 arguments, not 2" {
+		t.Errorf("Error expected selecting function: %v", err)
+	}
+}
+
+func TestRowType(t *testing.T) {
+	rt := rowType([]string{"cnt_id", "cnt name", "Cnt_id"})
+	var names []string
+	for i := 0; i < rt.NumField(); i++ {
+		names = append(names, rt.Field(i).Name+" "+rt.Field(i).Tag.Get("pgproc"))
+	}
+	if strings.Join(names, ",") != "Cnt_id cnt_id,Column1 cnt name,Column2 Cnt_id" {
+		t.Errorf("Error row fields: %v", names)
+	}
+}
+
+func TestCallProc(t *testing.T) {
+	p, err := pgproc.NewPgProc(conninfo)
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	res, err := callProc(context.Background(), p, "tests.test_returns_incremented_integer", []string{"41"})
+	if err != nil || len(res.rows) != 1 || *res.rows[0][0] != "42" {
+		t.Errorf("Error calling scalar function: %v %v", res, err)
+	}
+	res, err = callProc(context.Background(), p, "tests.test_returns_setof_composite", nil)
+	if err != nil || !res.setof || !res.composite || len(res.rows) != 2 || *res.rows[1][1] != "bye" {
+		t.Errorf("Error calling setof composite function: %v %v", res, err)
+	}
+	res, err = callProc(context.Background(), p, "tests.test_described", []string{"41", "hello"})
+	if err != nil || !res.composite || strings.Join(res.columns, ",") != "c,d" || *res.rows[0][1] != "hello" {
+		t.Errorf("Error calling function with OUT arguments: %v %v", res, err)
+	}
+	if _, err := callProc(context.Background(), p, "tests.test_returns_incremented_integer", []string{"a"}); err == nil {
+		t.Errorf("Error expected calling with an invalid argument")
+	}
+}
+
+func TestNamedArgs(t *testing.T) {
+	in := []pgproc.Argument{{Name: "a"}, {Name: "b"}}
+	for args, expected := range map[string]string{
+		"b=2 a=1":   "1 2",
+		"1 2":       "1 2",
+		"a=1 c=2":   "a=1 c=2",
+		"a=1 2":     "a=1 2",
+		"a=x=y b=2": "x=y 2",
+	} {
+		if ordered := namedArgs(in, strings.Fields(args)); strings.Join(ordered, " ") != expected {
+			t.Errorf("Error ordering %s: %v", args, ordered)
+		}
+	}
+}
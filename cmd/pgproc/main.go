@@ -0,0 +1,61 @@
+// Command pgproc calls PostgreSQL procedures from the command line,
+// through pgproc.
+//
+// Usage:
+//
+//	pgproc [-conninfo conninfo] call [-format json|table|csv] schema.proc [args...]
+//	pgproc [-conninfo conninfo] repl [-format json|table|csv] [-history file]
+//
+// The connection string defaults to the PGPROC_CONNINFO environment variable.
+// The arguments are converted to the types of the arguments of the procedure,
+// found by their number; \N is the NULL value. The arguments can also be
+// given by name, as name=value. Flags can follow the arguments; use --
+// before negative numbers:
+//
+//	pgproc call tests.content_get 3 -format json
+//	pgproc call tests.content_get prm_id=3
+//	pgproc call tests.test_returns_incremented_integer -- -1
+//
+// The repl command reads calls (schema.proc args...) and commands
+// (\d schema.proc to describe a function, \? for the list) interactively,
+// completing schema, function and argument names with the tab key.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/feloy/pgproc"
+)
+
+func main() {
+	conninfo := flag.String("conninfo", os.Getenv("PGPROC_CONNINFO"), "connection string to the database (default $PGPROC_CONNINFO)")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	p, err := pgproc.NewPgProc(*conninfo)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pgproc:", err)
+		os.Exit(1)
+	}
+	switch command, args := flag.Arg(0), flag.Args()[1:]; command {
+	case "call":
+		os.Exit(call(p, args))
+	case "repl":
+		os.Exit(repl(p, args))
+	default:
+		fmt.Fprintf(os.Stderr, "pgproc: unknown command %s\n", command)
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: pgproc [-conninfo conninfo] call [-format json|table|csv] schema.proc [args...]")
+	fmt.Fprintln(os.Stderr, "       pgproc [-conninfo conninfo] repl [-format json|table|csv] [-history file]")
+	flag.PrintDefaults()
+}
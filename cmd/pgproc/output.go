@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// jsonValue returns the JSON value of a text value of the PostgreSQL type typname
+func jsonValue(text *string, typname string) json.RawMessage {
+	if text == nil {
+		return json.RawMessage("null")
+	}
+	switch typname {
+	case "bool":
+		if *text == "t" || *text == "true" {
+			return json.RawMessage("true")
+		}
+		return json.RawMessage("false")
+	case "int2", "int4", "int8", "oid", "float4", "float8", "numeric":
+		if _, err := strconv.ParseFloat(*text, 64); err == nil {
+			return json.RawMessage(*text)
+		}
+	case "json", "jsonb":
+		if json.Valid([]byte(*text)) {
+			return json.RawMessage(*text)
+		}
+	}
+	data, _ := json.Marshal(*text)
+	return data
+}
+
+// writeJSON writes the result as JSON: an object per composite value,
+// an array for a set of rows
+func writeJSON(w io.Writer, res *result) error {
+	if res.columns == nil {
+		return nil
+	}
+	values := make([]interface{}, len(res.rows))
+	for i, row := range res.rows {
+		if !res.composite {
+			values[i] = jsonValue(row[0], res.types[0])
+			continue
+		}
+		object := map[string]json.RawMessage{}
+		for j, text := range row {
+			object[res.columns[j]] = jsonValue(text, res.types[j])
+		}
+		values[i] = object
+	}
+	var v interface{} = values
+	if !res.setof {
+		v = values[0]
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// textOf returns the text of a value, empty for NULL
+func textOf(text *string) string {
+	if text == nil {
+		return ""
+	}
+	return *text
+}
+
+// writeTable writes the result as a table with aligned columns
+func writeTable(w io.Writer, res *result) error {
+	if res.columns == nil {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	writeRow := func(values []string) {
+		for i, value := range values {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, value)
+		}
+		fmt.Fprint(tw, "\n")
+	}
+	writeRow(res.columns)
+	separators := make([]string, len(res.columns))
+	for i, column := range res.columns {
+		separators[i] = strings.Repeat("-", len(column))
+	}
+	writeRow(separators)
+	for _, row := range res.rows {
+		values := make([]string, len(row))
+		for i, text := range row {
+			values[i] = textOf(text)
+		}
+		writeRow(values)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "(%d rows)\n", len(res.rows))
+	return err
+}
+
+// writeCSV writes the result as CSV, with a header
+func writeCSV(w io.Writer, res *result) error {
+	if res.columns == nil {
+		return nil
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(res.columns)
+	for _, row := range res.rows {
+		values := make([]string, len(row))
+		for i, text := range row {
+			values[i] = textOf(text)
+		}
+		cw.Write(values)
+	}
+	cw.Flush()
+	return cw.Error()
+}
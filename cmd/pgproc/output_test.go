@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func text(s string) *string {
+	return &s
+}
+
+func testResult() *result {
+	return &result{
+		columns:   []string{"cnt_id", "cnt_name", "cnt_tags"},
+		types:     []string{"int4", "text", "jsonb"},
+		rows:      [][]*string{{text("1"), text("a, b"), text(`["x"]`)}, {text("2"), nil, nil}},
+		setof:     true,
+		composite: true,
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, &result{columns: []string{"f"}, types: []string{"bool"}, rows: [][]*string{{text("t")}}}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "true\n" {
+		t.Errorf("Error writing scalar: %q", buf.String())
+	}
+	buf.Reset()
+	if err := writeJSON(&buf, testResult()); err != nil {
+		t.Fatal(err)
+	}
+	expected := `[
+  {
+    "cnt_id": 1,
+    "cnt_name": "a, b",
+    "cnt_tags": [
+      "x"
+    ]
+  },
+  {
+    "cnt_id": 2,
+    "cnt_name": null,
+    "cnt_tags": null
+  }
+]
+`
+	if buf.String() != expected {
+		t.Errorf("Error writing rows: %s", buf.String())
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeTable(&buf, testResult()); err != nil {
+		t.Fatal(err)
+	}
+	expected := `cnt_id  cnt_name  cnt_tags
+------  --------  --------
+1       a, b      ["x"]
+2                 
+(2 rows)
+`
+	if buf.String() != expected {
+		t.Errorf("Error writing table:\n%s", buf.String())
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, testResult()); err != nil {
+		t.Fatal(err)
+	}
+	expected := "cnt_id,cnt_name,cnt_tags\n1,\"a, b\",\"[\"\"x\"\"]\"\n2,,\n"
+	if buf.String() != expected {
+		t.Errorf("Error writing csv: %q", buf.String())
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/feloy/pgproc"
+	"golang.org/x/term"
+)
+
+// repl runs the repl command, and returns the exit status
+func repl(p *pgproc.PgProc, args []string) int {
+	flags := flag.NewFlagSet("pgproc repl", flag.ExitOnError)
+	var (
+		format      = flags.String("format", "table", "output format: json, table or csv")
+		historyFile = flags.String("history", defaultHistoryFile(), "file keeping the history of the calls")
+	)
+	flags.Parse(args)
+	if _, found := formats[*format]; !found {
+		fmt.Fprintf(os.Stderr, "pgproc repl: unknown format %s\n", *format)
+		return 2
+	}
+	s := &session{p: p, catalog: &catalog{p: p}, format: *format, out: os.Stdout}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if s.execute(context.Background(), scanner.Text()) {
+				break
+			}
+		}
+		return 0
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pgproc repl:", err)
+		return 1
+	}
+	defer term.Restore(fd, state)
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "pgproc> ")
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return s.catalog.completeLine(t, line, pos)
+	}
+	s.out = t
+
+	var history *os.File
+	if *historyFile != "" {
+		if data, err := os.ReadFile(*historyFile); err == nil {
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				if line != "" {
+					t.History.Add(line)
+				}
+			}
+		}
+		history, _ = os.OpenFile(*historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if history != nil {
+			defer history.Close()
+		}
+	}
+	fmt.Fprintln(t, `Type \? for help, \q to quit`)
+	for {
+		line, err := t.ReadLine()
+		if err != nil {
+			break
+		}
+		if history != nil && strings.TrimSpace(line) != "" {
+			fmt.Fprintln(history, line)
+		}
+		if s.execute(context.Background(), line) {
+			break
+		}
+	}
+	return 0
+}
+
+// defaultHistoryFile returns the path of the history file in the home directory
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".pgproc_history")
+}
+
+// session holds the state of a repl session
+type session struct {
+	p       *pgproc.PgProc
+	catalog *catalog
+	format  string
+	out     io.Writer
+	history []entry
+}
+
+// entry is a call of the history, with its output
+type entry struct {
+	line   string
+	output string
+}
+
+const help = `schema.proc [args...]  call a procedure, with positional or name=value arguments
+\d [schema[.proc]]     list the schemas, the functions of a schema, or describe a function
+\format [json|table|csv]
+                       show or set the output format
+\history [n]           list the calls, or show the result of the call n
+\q                     quit
+`
+
+// execute executes a line, and returns true to quit
+func (s *session) execute(ctx context.Context, line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+	words, err := splitWords(line)
+	if err != nil {
+		fmt.Fprintln(s.out, "error:", err)
+		return false
+	}
+	switch words[0] {
+	case `\q`:
+		return true
+	case `\?`:
+		fmt.Fprint(s.out, help)
+	case `\d`:
+		s.describe(words[1:])
+	case `\format`:
+		if len(words) > 1 {
+			if _, found := formats[words[1]]; !found {
+				fmt.Fprintf(s.out, "error: unknown format %s\n", words[1])
+				return false
+			}
+			s.format = words[1]
+		}
+		fmt.Fprintln(s.out, "format:", s.format)
+	case `\history`:
+		s.showHistory(words[1:])
+	default:
+		if strings.HasPrefix(words[0], `\`) {
+			fmt.Fprintf(s.out, "error: unknown command %s, try \\?\n", words[0])
+			return false
+		}
+		var buf bytes.Buffer
+		res, err := callProc(ctx, s.p, words[0], words[1:])
+		if err == nil {
+			err = formats[s.format](&buf, res)
+		}
+		if err != nil {
+			fmt.Fprintln(&buf, "error:", err)
+		}
+		s.history = append(s.history, entry{line: line, output: buf.String()})
+		s.out.Write(buf.Bytes())
+	}
+	return false
+}
+
+// describe lists the schemas, the functions of a schema, or describes a function
+func (s *session) describe(args []string) {
+	if len(args) == 0 {
+		for _, schema := range s.catalog.listSchemas() {
+			fmt.Fprintln(s.out, schema)
+		}
+		return
+	}
+	schema, proc := args[0], ""
+	if i := strings.IndexByte(schema, '.'); i >= 0 {
+		schema, proc = schema[:i], schema[i+1:]
+	}
+	var found bool
+	for _, fn := range s.catalog.listFunctions(schema) {
+		if proc != "" && fn.Name != proc {
+			continue
+		}
+		found = true
+		fmt.Fprintln(s.out, signature(fn))
+		if proc == "" {
+			continue
+		}
+		attributes := []string{fn.Volatility}
+		if fn.Strict {
+			attributes = append(attributes, "strict")
+		}
+		if fn.SecurityDefiner {
+			attributes = append(attributes, "security definer")
+		}
+		attributes = append(attributes, "language "+fn.Language)
+		fmt.Fprintln(s.out, "  "+strings.Join(attributes, ", "))
+		for _, line := range strings.Split(fn.Comment, "\n") {
+			if line != "" {
+				fmt.Fprintln(s.out, "  "+line)
+			}
+		}
+	}
+	if !found {
+		fmt.Fprintf(s.out, "error: %s not found\n", args[0])
+	}
+}
+
+// signature returns the signature of a function
+func signature(fn pgproc.Function) string {
+	var args []string
+	for _, arg := range fn.Args {
+		var parts []string
+		if arg.Mode != "in" {
+			parts = append(parts, arg.Mode)
+		}
+		if arg.Name != "" {
+			parts = append(parts, arg.Name)
+		}
+		parts = append(parts, arg.Type)
+		if arg.Default != "" {
+			parts = append(parts, "DEFAULT", arg.Default)
+		}
+		args = append(args, strings.Join(parts, " "))
+	}
+	result := fn.Result.Type
+	if fn.Result.Setof {
+		result = "SETOF " + result
+	}
+	return fmt.Sprintf("%s.%s(%s) RETURNS %s", fn.Schema, fn.Name, strings.Join(args, ", "), result)
+}
+
+// showHistory lists the calls of the session, or shows the result of one
+func (s *session) showHistory(args []string) {
+	if len(args) == 0 {
+		for i, e := range s.history {
+			fmt.Fprintf(s.out, "%4d  %s\n", i+1, e.line)
+		}
+		return
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(s.history) {
+		fmt.Fprintf(s.out, "error: no call %s in the history\n", args[0])
+		return
+	}
+	e := s.history[n-1]
+	fmt.Fprintln(s.out, e.line)
+	fmt.Fprint(s.out, e.output)
+}
+
+// splitWords splits a line into words separated by spaces;
+// single or double quotes enclose words containing spaces
+func splitWords(line string) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		quote  rune
+		inWord bool
+	)
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// catalog caches the schemas and the functions of the database
+type catalog struct {
+	p         *pgproc.PgProc
+	schemas   []string
+	functions map[string][]pgproc.Function
+}
+
+// listSchemas returns the schemas of the database, read once
+func (c *catalog) listSchemas() []string {
+	if c.schemas == nil && c.p != nil {
+		c.schemas, _ = c.p.ListSchemas()
+	}
+	return c.schemas
+}
+
+// listFunctions returns the functions of schema, read once
+func (c *catalog) listFunctions(schema string) []pgproc.Function {
+	if c.functions == nil {
+		c.functions = map[string][]pgproc.Function{}
+	}
+	functions, found := c.functions[schema]
+	if !found && c.p != nil {
+		functions, _ = c.p.ListFunctions(schema)
+		c.functions[schema] = functions
+	}
+	return functions
+}
+
+var commands = []string{`\?`, `\d`, `\format`, `\history`, `\q`}
+
+// complete returns the sorted candidates completing the word ending at pos
+// in line, and the position of the start of the word
+func (c *catalog) complete(line string, pos int) ([]string, int) {
+	start := strings.LastIndexAny(line[:pos], " \t") + 1
+	word := line[start:pos]
+	previous := strings.Fields(line[:start])
+	candidates := map[string]bool{}
+	switch {
+	case len(previous) == 0 && strings.HasPrefix(word, `\`):
+		for _, command := range commands {
+			if strings.HasPrefix(command, word) {
+				candidates[command] = true
+			}
+		}
+	case len(previous) == 0 || len(previous) == 1 && previous[0] == `\d`:
+		if i := strings.IndexByte(word, '.'); i >= 0 {
+			schema := word[:i]
+			for _, fn := range c.listFunctions(schema) {
+				if strings.HasPrefix(fn.Name, word[i+1:]) {
+					candidates[schema+"."+fn.Name] = true
+				}
+			}
+		} else {
+			for _, schema := range c.listSchemas() {
+				if strings.HasPrefix(schema, word) {
+					candidates[schema+"."] = true
+				}
+			}
+		}
+	case !strings.HasPrefix(previous[0], `\`) && !strings.Contains(word, "="):
+		// argument names of the function
+		i := strings.IndexByte(previous[0], '.')
+		if i < 0 {
+			break
+		}
+		schema, proc := previous[0][:i], previous[0][i+1:]
+		for _, fn := range c.listFunctions(schema) {
+			if fn.Name != proc {
+				continue
+			}
+			for _, arg := range fn.InArgs() {
+				if arg.Name != "" && strings.HasPrefix(arg.Name, word) {
+					candidates[arg.Name+"="] = true
+				}
+			}
+		}
+	}
+	list := make([]string, 0, len(candidates))
+	for candidate := range candidates {
+		list = append(list, candidate)
+	}
+	sort.Strings(list)
+	return list, start
+}
+
+// completeLine completes the word ending at pos in line, up to the common
+// prefix of the candidates, which are written to w when ambiguous
+func (c *catalog) completeLine(w io.Writer, line string, pos int) (string, int, bool) {
+	candidates, start := c.complete(line, pos)
+	if len(candidates) == 0 {
+		return line, pos, true
+	}
+	prefix := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(candidates) == 1 && !strings.HasSuffix(prefix, ".") && !strings.HasSuffix(prefix, "=") {
+		prefix += " "
+	}
+	if len(prefix) > pos-start {
+		return line[:start] + prefix + line[pos:], start + len(prefix), true
+	}
+	fmt.Fprintln(w, strings.Join(candidates, "  "))
+	return line, pos, true
+}
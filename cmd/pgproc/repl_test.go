@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/feloy/pgproc"
+)
+
+func testCatalog() *catalog {
+	return &catalog{
+		schemas: []string{"public", "tests", "tools"},
+		functions: map[string][]pgproc.Function{
+			"tests": {
+				{Schema: "tests", Name: "content_add", Volatility: "volatile", Language: "plpgsql",
+					Args:    []pgproc.Argument{{Name: "prm_name", Type: "text", Mode: "in"}},
+					Result:  pgproc.Result{Type: "int4"},
+					Comment: "Adds a content"},
+				{Schema: "tests", Name: "content_get", Volatility: "stable", Strict: true, Language: "plpgsql",
+					Args:   []pgproc.Argument{{Name: "prm_id", Type: "int4", Mode: "in"}, {Name: "prm_lang", Type: "text", Mode: "in", Default: "'en'::text"}},
+					Result: pgproc.Result{Type: "content", Setof: true}},
+			},
+		},
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	words, err := splitWords(`tests.content_add 'a b' "" \N prm_name="c d"`)
+	if err != nil || strings.Join(words, "|") != `tests.content_add|a b||\N|prm_name=c d` {
+		t.Errorf("Error splitting words: %q %v", words, err)
+	}
+	if _, err := splitWords(`tests.content_add 'a`); err == nil {
+		t.Errorf("Error expected unterminated quote")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	c := testCatalog()
+	for line, expected := range map[string]string{
+		"t":                         "tests. tools.",
+		"tests.con":                 "tests.content_add tests.content_get",
+		"tests.content_g":           "tests.content_get",
+		`\d tests.content_a`:        "tests.content_add",
+		`\f`:                        `\format`,
+		"tests.content_get ":        "prm_id= prm_lang=",
+		"tests.content_get 3 prm_l": "prm_lang=",
+		"tests.content_get a=":      "",
+		"unknown.":                  "",
+	} {
+		candidates, _ := c.complete(line, len(line))
+		if strings.Join(candidates, " ") != expected {
+			t.Errorf("Error completing %q: %v", line, candidates)
+		}
+	}
+}
+
+func TestCompleteLine(t *testing.T) {
+	c := testCatalog()
+	var buf bytes.Buffer
+	line, pos, _ := c.completeLine(&buf, "tests.con x", 9)
+	if line != "tests.content_ x" || pos != 14 {
+		t.Errorf("Error completing to the common prefix: %q %d", line, pos)
+	}
+	line, pos, _ = c.completeLine(&buf, line, pos)
+	if line != "tests.content_ x" || buf.String() != "tests.content_add  tests.content_get\n" {
+		t.Errorf("Error listing candidates: %q %q", line, buf.String())
+	}
+	line, pos, _ = c.completeLine(&buf, "tests.content_g", 15)
+	if line != "tests.content_get " || pos != 18 {
+		t.Errorf("Error completing single candidate: %q %d", line, pos)
+	}
+}
+
+func TestExecuteCommands(t *testing.T) {
+	var buf bytes.Buffer
+	s := &session{catalog: testCatalog(), format: "table", out: &buf}
+	ctx := context.Background()
+
+	s.execute(ctx, `\d tests.content_get`)
+	expected := `tests.content_get(prm_id int4, prm_lang text DEFAULT 'en'::text) RETURNS SETOF content
+  stable, strict, language plpgsql
+`
+	if buf.String() != expected {
+		t.Errorf("Error describing function:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	s.execute(ctx, `\d tests`)
+	if strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("Error listing functions:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	s.execute(ctx, `\format json`)
+	if s.format != "json" {
+		t.Errorf("Error setting format")
+	}
+	s.execute(ctx, `\format xml`)
+	if s.format != "json" || !strings.Contains(buf.String(), "unknown format") {
+		t.Errorf("Error expected unknown format")
+	}
+
+	s.history = []entry{{line: "tests.content_add a", output: "1\n"}}
+	buf.Reset()
+	s.execute(ctx, `\history`)
+	s.execute(ctx, `\history 1`)
+	if buf.String() != "   1  tests.content_add a\ntests.content_add a\n1\n" {
+		t.Errorf("Error showing history: %q", buf.String())
+	}
+
+	if !s.execute(ctx, `\q`) {
+		t.Errorf("Error expected quit")
+	}
+}
+
+func TestExecuteCall(t *testing.T) {
+	p, err := pgproc.NewPgProc(conninfo)
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	var buf bytes.Buffer
+	s := &session{p: p, catalog: &catalog{p: p}, format: "json", out: &buf}
+	s.execute(context.Background(), "tests.test_returns_incremented_integer n=41")
+	if buf.String() != "42\n" || len(s.history) != 1 {
+		t.Errorf("Error calling: %q", buf.String())
+	}
+}
@@ -0,0 +1,60 @@
+package pgproc
+
+import (
+	"reflect"
+)
+
+// Codec converts values of a PostgreSQL type from and to Go values,
+// for types pgproc does not know about (types of extensions for example)
+type Codec interface {
+	// Encode returns the textual form of the non-nil parameter v
+	Encode(v interface{}) (string, error)
+	// Decode stores the non-NULL value src, as returned by the database,
+	// into dest, a pointer to a Go value
+	Decode(src []byte, dest interface{}) error
+}
+
+// RegisterType registers the codec to use for the values of the PostgreSQL
+// type typname (as named in pg_type, ltree or geometry for example),
+// and for the elements of arrays of this type.
+// RegisterType must be called before the PgProc is used.
+func (p *PgProc) RegisterType(typname string, codec Codec) {
+	if p.codecs == nil {
+		p.codecs = map[string]Codec{}
+	}
+	p.codecs[typname] = codec
+}
+
+// codecDecoder returns a decodeFunc decoding a value of the PostgreSQL type
+// typname with its registered codec, or nil if no codec is registered
+func (p *PgProc) codecDecoder(t reflect.Type, typname string) decodeFunc {
+	codec, found := p.codecs[typname]
+	if !found {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		// let pointerDecoder handle NULL values
+		return nil
+	}
+	return func(dest reflect.Value, src interface{}) error {
+		if src == nil {
+			return setNull(dest)
+		}
+		text, err := textOf(src)
+		if err != nil {
+			return err
+		}
+		return codec.Decode([]byte(text), dest.Addr().Interface())
+	}
+}
+
+// encodeCodec returns the textual form of param with the codec registered
+// for the PostgreSQL type typname; ok is false if no codec is registered
+func (p *PgProc) encodeCodec(param interface{}, typname string) (value interface{}, ok bool, err error) {
+	codec, found := p.codecs[typname]
+	if !found {
+		return nil, false, nil
+	}
+	text, err := codec.Encode(param)
+	return text, true, err
+}
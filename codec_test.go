@@ -0,0 +1,103 @@
+package pgproc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type Point struct {
+	X, Y float64
+}
+
+type pointCodec struct{}
+
+func (pointCodec) Encode(v interface{}) (string, error) {
+	switch p := v.(type) {
+	case Point:
+		return fmt.Sprintf("(%g,%g)", p.X, p.Y), nil
+	case *Point:
+		return fmt.Sprintf("(%g,%g)", p.X, p.Y), nil
+	}
+	return "", fmt.Errorf("cannot encode %T as a point", v)
+}
+
+func (pointCodec) Decode(src []byte, dest interface{}) error {
+	p, ok := dest.(*Point)
+	if !ok {
+		return errors.New("point must be decoded into a Point")
+	}
+	_, err := fmt.Sscanf(string(src), "(%g,%g)", &p.X, &p.Y)
+	return err
+}
+
+type Place struct {
+	PlcName     string  `pgproc:"plc_name"`
+	PlcLocation *Point  `pgproc:"plc_location"`
+	PlcArea     []Point `pgproc:"plc_area"`
+}
+
+func connectWithPoint() *PgProc {
+	p, _ := connect()
+	p.RegisterType("point", pointCodec{})
+	return p
+}
+
+func TestRegisterTypeScalar(t *testing.T) {
+	p := connectWithPoint()
+	var res Point
+	input := Point{1.5, -2}
+	err := p.Call(&res, "tests", "test_returns_same_point", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_point: %s", err)
+	}
+	if res != input {
+		t.Errorf("Error expected %v value is %v", input, res)
+	}
+
+	var ptr *Point
+	err = p.Call(&ptr, "tests", "test_returns_same_point", (*Point)(nil))
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_point: %s", err)
+	}
+	if ptr != nil {
+		t.Errorf("Error expected nil value is %v", ptr)
+	}
+}
+
+func TestRegisterTypeSetof(t *testing.T) {
+	p := connectWithPoint()
+	ch := make(chan Point)
+	go p.Call(ch, "tests", "test_returns_setof_point")
+	a := <-ch
+	b := <-ch
+	if a != (Point{1, 2}) || b != (Point{3.5, -4}) {
+		t.Errorf("Error expected values are %v %v", a, b)
+	}
+}
+
+func TestRegisterTypeArray(t *testing.T) {
+	p := connectWithPoint()
+	var res []Point
+	input := []Point{{0, 0}, {2, 4}}
+	err := p.Call(&res, "tests", "test_returns_point_array", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_point_array: %s", err)
+	}
+	if len(res) != 2 || res[0] != input[0] || res[1] != input[1] {
+		t.Errorf("Error expected values are %v", res)
+	}
+}
+
+func TestRegisterTypeComposite(t *testing.T) {
+	p := connectWithPoint()
+	var res Place
+	err := p.Call(&res, "tests", "test_returns_place")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_place: %s", err)
+	}
+	if res.PlcName != "home" || res.PlcLocation == nil || *res.PlcLocation != (Point{1, 2}) ||
+		len(res.PlcArea) != 2 || res.PlcArea[1] != (Point{2, 4}) {
+		t.Errorf("Error expected value is %v", res)
+	}
+}
@@ -0,0 +1,107 @@
+package pgproc
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SetComment sets the tags of the sqlcommenter comment prefixing the query
+// of each call, for example service or route, for the calls to be
+// correlated with their origin in pg_stat_activity and in the logs:
+//
+//	/*route='%2Forders',service='shop'*/ SELECT * FROM "api"."my_orders"()
+//
+// The tags can be overridden per call with WithComment.
+// SetComment must be called before the PgProc is used.
+func (p *PgProc) SetComment(tags map[string]string) {
+	p.comment = tags
+}
+
+// SetApplicationName sets the application_name set locally (SET LOCAL)
+// in the transaction of each call, visible in pg_stat_activity; the calls
+// run in a transaction when it is not empty. It can be overridden per call
+// with WithApplicationName.
+// SetApplicationName must be called before the PgProc is used.
+func (p *PgProc) SetApplicationName(name string) {
+	p.applicationName = name
+}
+
+type commentKey struct{}
+
+type applicationNameKey struct{}
+
+// WithComment returns a copy of ctx adding tags to the comment of the calls
+// done with it, overriding the tags of SetComment; a tag with an empty value
+// removes the tag
+func WithComment(ctx context.Context, tags map[string]string) context.Context {
+	merged := map[string]string{}
+	if previous, ok := ctx.Value(commentKey{}).(map[string]string); ok {
+		for k, v := range previous {
+			merged[k] = v
+		}
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, commentKey{}, merged)
+}
+
+// WithApplicationName returns a copy of ctx making the calls done with it
+// set application_name locally to name, overriding SetApplicationName
+func WithApplicationName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, applicationNameKey{}, name)
+}
+
+// traceParent is implemented by the spans giving their W3C traceparent,
+// added to the comment of the queries
+type traceParent interface {
+	TraceParent() string
+}
+
+// queryComment returns the comment prefixing the query of a call done
+// with ctx and traced by span, or an empty string
+func (p *PgProc) queryComment(ctx context.Context, span Span) string {
+	tags := map[string]string{}
+	for k, v := range p.comment {
+		tags[k] = v
+	}
+	if tp, ok := span.(traceParent); ok {
+		tags["traceparent"] = tp.TraceParent()
+	}
+	if override, ok := ctx.Value(commentKey{}).(map[string]string); ok {
+		for k, v := range override {
+			tags[k] = v
+		}
+	}
+	return formatComment(tags)
+}
+
+// formatComment formats tags as a sqlcommenter comment: sorted keys and
+// values URL-encoded, values quoted, which cannot contain */
+func formatComment(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = url.PathEscape(k) + "='" + url.PathEscape(tags[k]) + "'"
+	}
+	return "/*" + strings.Join(pairs, ",") + "*/ "
+}
+
+// applicationNameOf returns the application_name of the calls done with ctx
+func (p *PgProc) applicationNameOf(ctx context.Context) string {
+	if name, ok := ctx.Value(applicationNameKey{}).(string); ok && name != "" {
+		return name
+	}
+	return p.applicationName
+}
@@ -0,0 +1,79 @@
+package pgproc
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// traceParentSpan is a span giving its traceparent
+type traceParentSpan struct {
+	noopSpan
+}
+
+func (traceParentSpan) TraceParent() string {
+	return "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+}
+
+func TestFormatComment(t *testing.T) {
+	for _, c := range []struct {
+		tags     map[string]string
+		expected string
+	}{
+		{nil, ""},
+		{map[string]string{"route": ""}, ""},
+		{map[string]string{"service": "shop", "route": "/orders/{id}"}, "/*route='%2Forders%2F%7Bid%7D',service='shop'*/ "},
+		{map[string]string{"x y": "*/ DROP TABLE t; /*", "q": "it's"}, "/*q='it%27s',x%20y='%2A%2F%20DROP%20TABLE%20t%3B%20%2F%2A'*/ "},
+	} {
+		if s := formatComment(c.tags); s != c.expected {
+			t.Errorf("Error formatting %v: %s, expected %s", c.tags, s, c.expected)
+		}
+	}
+}
+
+func TestQueryComment(t *testing.T) {
+	var p PgProc
+	p.SetComment(map[string]string{"service": "shop", "route": "default"})
+	ctx := WithComment(context.Background(), map[string]string{"route": "orders"})
+	ctx = WithComment(ctx, map[string]string{"service": ""})
+	if s := p.queryComment(ctx, noopSpan{}); s != "/*route='orders'*/ " {
+		t.Errorf("Error in comment: %s", s)
+	}
+	s := p.queryComment(context.Background(), traceParentSpan{})
+	if !strings.Contains(s, "traceparent='00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01'") {
+		t.Errorf("Error expected traceparent in comment: %s", s)
+	}
+
+	p.SetApplicationName("shop")
+	if name := p.applicationNameOf(WithApplicationName(context.Background(), "shop-batch")); name != "shop-batch" {
+		t.Errorf("Error expected overridden application name: %s", name)
+	}
+	if name := p.applicationNameOf(context.Background()); name != "shop" {
+		t.Errorf("Error expected default application name: %s", name)
+	}
+}
+
+func TestSetComment(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	p.SetComment(map[string]string{"service": "shop"})
+	p.SetApplicationName("shop")
+	var query string
+	ctx := WithComment(context.Background(), map[string]string{"route": "/orders"})
+	if err := p.CallContext(ctx, &query, "tests", "test_current_query"); err != nil {
+		t.Fatalf("Error calling: %s", err)
+	}
+	if !strings.HasPrefix(query, `/*route='%2Forders',service='shop'*/ SELECT * FROM "tests"."test_current_query"()`) {
+		t.Errorf("Error expected comment in query: %s", query)
+	}
+	var name string
+	if err := p.Call(&name, "tests", "test_current_setting", "application_name"); err != nil || name != "shop" {
+		t.Errorf("Error expected application name shop: %s %v", name, err)
+	}
+	ctx = WithApplicationName(context.Background(), "shop-batch")
+	if err := p.CallContext(ctx, &name, "tests", "test_current_setting", "application_name"); err != nil || name != "shop-batch" {
+		t.Errorf("Error expected application name shop-batch: %s %v", name, err)
+	}
+}
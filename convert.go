@@ -0,0 +1,269 @@
+package pgproc
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// decodeFunc stores src, a value returned by the driver, into dest
+type decodeFunc func(dest reflect.Value, src interface{}) error
+
+// convertScanner is a sql.Scanner converting the scanned value with a decodeFunc
+type convertScanner struct {
+	dest   reflect.Value
+	decode decodeFunc
+}
+
+func (s *convertScanner) Scan(src interface{}) error {
+	return s.decode(s.dest, src)
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	bytesType   = reflect.TypeOf([]byte(nil))
+)
+
+// scanner returns the destination to give to Scan in order to store
+// a value of the PostgreSQL type typname into dest.
+// dest is returned unchanged when the driver can handle it directly.
+func (p *PgProc) scanner(dest interface{}, typname string) interface{} {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return dest
+	}
+	if decode := p.decoder(v.Type().Elem(), typname); decode != nil {
+		return &convertScanner{dest: v.Elem(), decode: decode}
+	}
+	return dest
+}
+
+// decoder returns the decodeFunc able to store a value of the PostgreSQL
+// type typname into a Go value of type t, or nil if none is needed
+func (p *PgProc) decoder(t reflect.Type, typname string) decodeFunc {
+	if decode := p.codecDecoder(t, typname); decode != nil {
+		return decode
+	}
+	if decode := numericDecoder(t); decode != nil {
+		return decode
+	}
+	if decode := networkDecoder(t, typname); decode != nil {
+		return decode
+	}
+	if decode := p.timeDecoder(t, typname); decode != nil {
+		return decode
+	}
+	if t.Kind() == reflect.Ptr && !t.Implements(scannerType) {
+		return p.pointerDecoder(t, typname)
+	}
+	if isArrayType(typname) && t.Kind() == reflect.Slice && t != bytesType &&
+		!reflect.PtrTo(t).Implements(scannerType) {
+		return p.arrayDecoder(t, typname[1:])
+	}
+	return nil
+}
+
+// pointerDecoder returns a decodeFunc storing a value into a pointer of type t,
+// allocating the pointed value, or nil if the pointed value cannot be decoded
+func (p *PgProc) pointerDecoder(t reflect.Type, typname string) decodeFunc {
+	decodeElem := p.decoder(t.Elem(), typname)
+	if decodeElem == nil {
+		return nil
+	}
+	return func(dest reflect.Value, src interface{}) error {
+		if src == nil {
+			return setNull(dest)
+		}
+		elem := reflect.New(t.Elem())
+		if err := decodeElem(elem.Elem(), src); err != nil {
+			return err
+		}
+		dest.Set(elem)
+		return nil
+	}
+}
+
+// isArrayType returns true if typname is the name of an array type
+func isArrayType(typname string) bool {
+	return len(typname) > 1 && typname[0] == '_'
+}
+
+// arrayDecoder returns a decodeFunc storing an array of elements of the
+// PostgreSQL type elemTypname into a slice of type t,
+// or nil if the elements cannot be decoded
+func (p *PgProc) arrayDecoder(t reflect.Type, elemTypname string) decodeFunc {
+	elem := t.Elem()
+	if reflect.PtrTo(elem).Implements(scannerType) {
+		return func(dest reflect.Value, src interface{}) error {
+			return pq.GenericArray{A: dest.Addr().Interface()}.Scan(src)
+		}
+	}
+	decodeElem := p.decoder(elem, elemTypname)
+	if decodeElem == nil {
+		decodeElem = basicDecoder(elem)
+	}
+	if decodeElem == nil {
+		return nil
+	}
+	return func(dest reflect.Value, src interface{}) error {
+		var texts []sql.NullString
+		if err := (pq.GenericArray{A: &texts}).Scan(src); err != nil {
+			return err
+		}
+		if texts == nil {
+			dest.Set(reflect.Zero(t))
+			return nil
+		}
+		slice := reflect.MakeSlice(t, len(texts), len(texts))
+		for i, text := range texts {
+			var elemSrc interface{}
+			if text.Valid {
+				elemSrc = text.String
+			}
+			if err := decodeElem(slice.Index(i), elemSrc); err != nil {
+				return err
+			}
+		}
+		dest.Set(slice)
+		return nil
+	}
+}
+
+// basicDecoder returns a decodeFunc storing the textual form of an array
+// element into a boolean, number or string Go value, or nil for other types
+func basicDecoder(t reflect.Type) decodeFunc {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		return nil
+	}
+	return func(dest reflect.Value, src interface{}) error {
+		if src == nil {
+			return setNull(dest)
+		}
+		text, err := textOf(src)
+		if err != nil {
+			return err
+		}
+		switch t.Kind() {
+		case reflect.Bool:
+			dest.SetBool(text == "t" || text == "true")
+		case reflect.String:
+			dest.SetString(text)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i, err := strconv.ParseInt(text, 10, t.Bits())
+			if err != nil {
+				return err
+			}
+			dest.SetInt(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			u, err := strconv.ParseUint(text, 10, t.Bits())
+			if err != nil {
+				return err
+			}
+			dest.SetUint(u)
+		case reflect.Float32, reflect.Float64:
+			f, err := strconv.ParseFloat(text, t.Bits())
+			if err != nil {
+				return err
+			}
+			dest.SetFloat(f)
+		}
+		return nil
+	}
+}
+
+// encodeParams converts the parameters given to Call to values the driver
+// accepts, given the names of the PostgreSQL types of the arguments
+func (p *PgProc) encodeParams(params []interface{}, argTypes []string) ([]interface{}, error) {
+	encoded := make([]interface{}, len(params))
+	for i, param := range params {
+		var typname string
+		if i < len(argTypes) {
+			typname = argTypes[i]
+		}
+		var err error
+		if encoded[i], err = p.encodeParam(param, typname); err != nil {
+			return nil, fmt.Errorf("parameter %d: %s", i+1, err)
+		}
+	}
+	return encoded, nil
+}
+
+// encodeParam converts a parameter to a value the driver accepts
+// for an argument of the PostgreSQL type typname
+func (p *PgProc) encodeParam(param interface{}, typname string) (interface{}, error) {
+	if param == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(param)
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, nil
+	}
+	if text, ok, err := p.encodeCodec(param, typname); ok {
+		return text, err
+	}
+	if _, ok := param.(driver.Valuer); ok {
+		return param, nil
+	}
+	if text, ok, err := encodeNumeric(param); ok {
+		return text, err
+	}
+	if text, ok := encodeNetwork(param); ok {
+		return text, nil
+	}
+	if t, ok := param.(time.Time); ok {
+		return p.encodeTime(t, typname), nil
+	}
+	if v.Kind() == reflect.Slice && v.Type() != bytesType {
+		if v.IsNil() {
+			return nil, nil
+		}
+		var elemTypname string
+		if isArrayType(typname) {
+			elemTypname = typname[1:]
+		}
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			var err error
+			if elems[i], err = p.encodeParam(v.Index(i).Interface(), elemTypname); err != nil {
+				return nil, err
+			}
+		}
+		return pq.GenericArray{A: elems}.Value()
+	}
+	return param, nil
+}
+
+// textOf returns the textual form of a value returned by the driver
+func textOf(src interface{}) (string, error) {
+	switch s := src.(type) {
+	case []byte:
+		return string(s), nil
+	case string:
+		return s, nil
+	case int64:
+		return strconv.FormatInt(s, 10), nil
+	case float64:
+		return strconv.FormatFloat(s, 'g', -1, 64), nil
+	}
+	return "", fmt.Errorf("cannot convert %T to text", src)
+}
+
+// setNull stores NULL into dest, which must be a pointer, a slice or a map
+func setNull(dest reflect.Value) error {
+	switch dest.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+	return fmt.Errorf("cannot convert NULL to %s", dest.Type())
+}
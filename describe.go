@@ -0,0 +1,277 @@
+package pgproc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ErrNotFound is returned by DescribeContext when no function matches
+var ErrNotFound = errors.New("function not found")
+
+// Function describes a function of the database catalog
+type Function struct {
+	Schema string
+	Name   string
+	// Args are all the arguments of the function, including
+	// its OUT and TABLE arguments
+	Args   []Argument
+	Result Result
+	// Volatility is immutable, stable or volatile
+	Volatility      string
+	Strict          bool
+	SecurityDefiner bool
+	Language        string
+	// Comment is the text of COMMENT ON FUNCTION
+	Comment string
+}
+
+// InArgs returns the input arguments of f, the ones given to Call
+func (f Function) InArgs() []Argument {
+	var in []Argument
+	for _, arg := range f.Args {
+		if arg.Mode == "in" || arg.Mode == "inout" || arg.Mode == "variadic" {
+			in = append(in, arg)
+		}
+	}
+	return in
+}
+
+// Accepts tells if f is the overload called with nargs arguments
+func (f Function) Accepts(nargs int) bool {
+	return len(f.InArgs()) == nargs
+}
+
+// Argument describes an argument of a function
+type Argument struct {
+	Name string
+	// Type is the name of the type in pg_type (_int4 for integer[])
+	Type string
+	// Mode is in, out, inout, variadic or table
+	Mode string
+	// Default is the default expression of the argument, empty if none
+	Default string
+}
+
+// Result describes the result of a function
+type Result struct {
+	// Type is the name of the type in pg_type (record for
+	// a function with OUT arguments)
+	Type  string
+	Setof bool
+	// Fields are the attributes of a composite result,
+	// or the OUT arguments of the function
+	Fields []Field
+}
+
+// Field is an attribute of a composite result
+type Field struct {
+	Name string
+	Type string
+}
+
+var (
+	volatilities = map[string]string{"i": "immutable", "s": "stable", "v": "volatile"}
+	argModes     = map[string]string{"i": "in", "o": "out", "b": "inout", "v": "variadic", "t": "table"}
+)
+
+// Describe describes the functions named proc in schema,
+// one per overload, ordered by their number of arguments
+func (p *PgProc) Describe(schema string, proc string) ([]Function, error) {
+	return p.DescribeContext(context.Background(), schema, proc)
+}
+
+// DescribeContext describes the functions named proc in schema,
+// one per overload, ordered by their number of arguments
+func (p *PgProc) DescribeContext(ctx context.Context, schema string, proc string) ([]Function, error) {
+	functions, err := p.describe(ctx, schema, proc)
+	if err != nil {
+		return nil, err
+	}
+	if len(functions) == 0 {
+		return nil, fmt.Errorf("%w: %s.%s", ErrNotFound, schema, proc)
+	}
+	return functions, nil
+}
+
+// ListFunctions describes all the functions of schema,
+// ordered by name and number of arguments
+func (p *PgProc) ListFunctions(schema string) ([]Function, error) {
+	return p.describe(context.Background(), schema, "")
+}
+
+// describe describes the functions named proc in schema,
+// or all the functions of schema if proc is empty
+func (p *PgProc) describe(ctx context.Context, schema string, proc string) ([]Function, error) {
+	query := `
+SELECT
+  pg_proc.oid,
+  proname,
+  provolatile,
+  proisstrict,
+  prosecdef,
+  lanname,
+  coalesce(obj_description(pg_proc.oid, 'pg_proc'), ''),
+  pg_type_ret.typname,
+  proretset,
+  (SELECT array_agg(attname ORDER BY attnum) FROM pg_attribute
+   WHERE attrelid = pg_type_ret.typrelid AND attnum > 0 AND NOT attisdropped),
+  (SELECT array_agg(typname ORDER BY attnum) FROM pg_attribute
+   INNER JOIN pg_type ON pg_attribute.atttypid = pg_type.oid
+   WHERE attrelid = pg_type_ret.typrelid AND attnum > 0 AND NOT attisdropped)
+FROM pg_proc
+INNER JOIN pg_type pg_type_ret ON pg_type_ret.oid = pg_proc.prorettype
+INNER JOIN pg_language ON pg_language.oid = pg_proc.prolang
+INNER JOIN pg_namespace pg_namespace_proc ON pg_namespace_proc.oid = pg_proc.pronamespace
+WHERE
+  pg_namespace_proc.nspname = $1 AND
+  ($2 = '' OR proname = $2) AND
+  NOT EXISTS (SELECT 1 FROM pg_aggregate WHERE aggfnoid = pg_proc.oid)
+ORDER BY proname, pronargs`
+
+	rows, err := p.db.QueryContext(ctx, query, schema, proc)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		functions []Function
+		oids      []int64
+	)
+	for rows.Next() {
+		var (
+			f          = Function{Schema: schema}
+			oid        int64
+			volatility string
+			names      pq.StringArray
+			types      pq.StringArray
+		)
+		err := rows.Scan(&oid, &f.Name, &volatility, &f.Strict, &f.SecurityDefiner, &f.Language,
+			&f.Comment, &f.Result.Type, &f.Result.Setof, &names, &types)
+		if err != nil {
+			return nil, err
+		}
+		f.Volatility = volatilities[volatility]
+		for i, name := range names {
+			f.Result.Fields = append(f.Result.Fields, Field{Name: name, Type: types[i]})
+		}
+		functions = append(functions, f)
+		oids = append(oids, oid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// the rows are read before querying the arguments,
+	// for the query not to wait for a connection
+	rows.Close()
+	for i := range functions {
+		if err := p.describeArgs(ctx, oids[i], &functions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return functions, nil
+}
+
+// describeArgs reads the arguments of the function oid into f
+func (p *PgProc) describeArgs(ctx context.Context, oid int64, f *Function) error {
+	query := `
+SELECT
+  coalesce(proargnames[ord::int], ''),
+  coalesce(proargmodes[ord::int]::text, 'i'),
+  typname,
+  coalesce(pg_get_function_arg_default(pg_proc.oid, ord::int), '')
+FROM pg_proc
+CROSS JOIN LATERAL unnest(coalesce(proallargtypes, proargtypes::oid[])) WITH ORDINALITY AS args(oid, ord)
+INNER JOIN pg_type ON pg_type.oid = args.oid
+WHERE pg_proc.oid = $1
+ORDER BY ord`
+
+	rows, err := p.db.QueryContext(ctx, query, oid)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	outArgs := f.Result.Fields == nil
+	n := 0
+	for rows.Next() {
+		var (
+			arg  Argument
+			mode string
+		)
+		if err := rows.Scan(&arg.Name, &mode, &arg.Type, &arg.Default); err != nil {
+			return err
+		}
+		arg.Mode = argModes[mode]
+		f.Args = append(f.Args, arg)
+		if outArgs && (mode == "o" || mode == "b" || mode == "t") {
+			// the unnamed OUT arguments give the columns column1, column2...
+			n++
+			name := arg.Name
+			if name == "" {
+				name = fmt.Sprintf("column%d", n)
+			}
+			f.Result.Fields = append(f.Result.Fields, Field{Name: name, Type: arg.Type})
+		}
+	}
+	return rows.Err()
+}
+
+// ListEnums returns the labels of the enum types of schema, by type name
+func (p *PgProc) ListEnums(schema string) (map[string][]string, error) {
+	query := `
+SELECT
+  typname,
+  array_agg(enumlabel ORDER BY enumsortorder)
+FROM pg_enum
+INNER JOIN pg_type ON pg_type.oid = pg_enum.enumtypid
+INNER JOIN pg_namespace ON pg_namespace.oid = pg_type.typnamespace
+WHERE nspname = $1
+GROUP BY typname`
+
+	rows, err := p.db.Query(query, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	enums := map[string][]string{}
+	for rows.Next() {
+		var (
+			name   string
+			labels pq.StringArray
+		)
+		if err := rows.Scan(&name, &labels); err != nil {
+			return nil, err
+		}
+		enums[name] = labels
+	}
+	return enums, rows.Err()
+}
+
+// ListSchemas returns the names of the schemas of the database,
+// except the system schemas
+func (p *PgProc) ListSchemas() ([]string, error) {
+	query := `
+SELECT nspname
+FROM pg_namespace
+WHERE
+  nspname NOT LIKE 'pg\_%' AND
+  nspname <> 'information_schema'
+ORDER BY nspname`
+
+	rows, err := p.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var schemas []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, rows.Err()
+}
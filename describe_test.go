@@ -0,0 +1,116 @@
+package pgproc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	functions, err := base.Describe("tests", "test_described")
+	if err != nil {
+		t.Fatalf("Error describing: %s", err)
+	}
+	if len(functions) != 1 {
+		t.Fatalf("Error expected one function: %v", functions)
+	}
+	f := functions[0]
+	if f.Volatility != "stable" || !f.Strict || !f.SecurityDefiner || f.Language != "sql" ||
+		f.Comment != "Describes the arguments" {
+		t.Errorf("Error in description: %+v", f)
+	}
+	args := []Argument{
+		{Name: "a", Type: "int4", Mode: "in"},
+		{Name: "b", Type: "text", Mode: "in", Default: "'none'::text"},
+		{Name: "c", Type: "int4", Mode: "out"},
+		{Name: "d", Type: "text", Mode: "out"},
+	}
+	if !reflect.DeepEqual(f.Args, args) {
+		t.Errorf("Error in arguments: %+v", f.Args)
+	}
+	result := Result{Type: "record", Fields: []Field{{"c", "int4"}, {"d", "text"}}}
+	if !reflect.DeepEqual(f.Result, result) {
+		t.Errorf("Error in result: %+v", f.Result)
+	}
+}
+
+func TestInArgs(t *testing.T) {
+	f := Function{Args: []Argument{
+		{Name: "a", Mode: "in"}, {Name: "b", Mode: "out"}, {Name: "c", Mode: "inout"},
+		{Name: "d", Mode: "variadic"}, {Name: "e", Mode: "table"},
+	}}
+	var names []string
+	for _, arg := range f.InArgs() {
+		names = append(names, arg.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "c", "d"}) {
+		t.Errorf("Error in input arguments: %v", names)
+	}
+	if !f.Accepts(3) || f.Accepts(5) {
+		t.Errorf("Error in accepted number of arguments")
+	}
+}
+
+func TestDescribeComposite(t *testing.T) {
+	functions, err := base.Describe("tests", "test_returns_setof_composite")
+	if err != nil {
+		t.Fatalf("Error describing: %s", err)
+	}
+	result := Result{Type: "composite1", Setof: true, Fields: []Field{{"a", "int4"}, {"b", "varchar"}}}
+	if !reflect.DeepEqual(functions[0].Result, result) {
+		t.Errorf("Error in result: %+v", functions[0].Result)
+	}
+}
+
+func TestDescribeUnknown(t *testing.T) {
+	if _, err := base.Describe("tests", "unknown_function"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Error expected describing an unknown function: %v", err)
+	}
+}
+
+func TestListFunctions(t *testing.T) {
+	functions, err := base.ListFunctions("tests")
+	if err != nil {
+		t.Fatalf("Error listing functions: %s", err)
+	}
+	found := false
+	for i, f := range functions {
+		if i > 0 && functions[i-1].Name > f.Name {
+			t.Errorf("Error functions not ordered by name")
+		}
+		if f.Schema != "tests" {
+			t.Errorf("Error function of schema %s", f.Schema)
+		}
+		found = found || f.Name == "content_get"
+	}
+	if !found {
+		t.Errorf("Error content_get not listed")
+	}
+}
+
+func TestListEnums(t *testing.T) {
+	enums, err := base.ListEnums("tests")
+	if err != nil {
+		t.Fatalf("Error listing enums: %s", err)
+	}
+	if !reflect.DeepEqual(enums["enumtype"], []string{"val1", "val2", "val3"}) {
+		t.Errorf("Error in enums: %v", enums)
+	}
+}
+
+func TestListSchemas(t *testing.T) {
+	schemas, err := base.ListSchemas()
+	if err != nil {
+		t.Fatalf("Error listing schemas: %s", err)
+	}
+	found := false
+	for _, schema := range schemas {
+		if schema == "pg_catalog" || schema == "information_schema" {
+			t.Errorf("Error system schema %s listed", schema)
+		}
+		found = found || schema == "tests"
+	}
+	if !found {
+		t.Errorf("Error tests schema not listed: %v", schemas)
+	}
+}
@@ -0,0 +1,439 @@
+// Package httpapi exposes PostgreSQL procedures called through pgproc
+// as a JSON-RPC over HTTP API.
+//
+// A request
+//
+//	POST /rpc/{schema}/{proc}
+//
+// with a JSON body containing an array of positional arguments, or an object
+// of named arguments, calls the procedure and returns its result as JSON.
+// The rows of a SETOF procedure are streamed as newline-delimited JSON.
+// The call policy of the PgProc is respected, and the calls can be done
+// under the role and with the claims of the bearer tokens of the requests,
+// see SetJWT.
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/feloy/pgproc"
+	"github.com/lib/pq"
+)
+
+// maxBodySize is the maximum size of the body of a request
+const maxBodySize = 1 << 20
+
+// Handler is an http.Handler calling procedures through a PgProc
+type Handler struct {
+	p   *pgproc.PgProc
+	jwt *JWTConfig
+}
+
+// NewHandler returns a Handler calling procedures through p
+func NewHandler(p *pgproc.PgProc) *Handler {
+	return &Handler{p: p}
+}
+
+// httpError is an error with the HTTP status to return
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func (e *httpError) Unwrap() error {
+	return e.err
+}
+
+func errorf(status int, format string, a ...interface{}) error {
+	return &httpError{status: status, err: fmt.Errorf(format, a...)}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+	schema, proc, err := parsePath(r.URL.Path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, errorf(http.StatusBadRequest, "cannot read body: %s", err))
+		return
+	}
+	call, err := parseArgs(body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.serveCall(w, r, schema, proc, call)
+}
+
+// serveCall calls the function and writes its result
+func (h *Handler) serveCall(w http.ResponseWriter, r *http.Request, schema string, proc string, call *args) {
+	ctx := r.Context()
+	if h.jwt != nil {
+		role, settings, err := h.jwt.session(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		ctx = pgproc.WithSession(ctx, role, settings)
+	}
+	if err := h.p.Callable(ctx, schema, proc, call.len()); err != nil {
+		writeError(w, err)
+		return
+	}
+	functions, err := h.p.DescribeContext(ctx, schema, proc)
+	if errors.Is(err, pgproc.ErrNotFound) {
+		writeError(w, errorf(http.StatusNotFound, "%s", err))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	fn, err := selectFunction(functions, call)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	params, err := call.params(fn)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if fn.Result.Type == "void" {
+		if err := h.p.CallContext(ctx, nil, schema, proc, params...); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	t := resultType(fn.Result)
+	if fn.Result.Setof {
+		h.stream(ctx, w, t, schema, proc, params)
+		return
+	}
+	result := reflect.New(t)
+	if err := h.p.CallContext(ctx, result.Interface(), schema, proc, params...); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResult(w, result.Interface())
+}
+
+// writeResult writes the result v as JSON, or an error if v cannot be
+// encoded, before the status is sent
+func writeResult(w http.ResponseWriter, v interface{}) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(v); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body.Bytes())
+}
+
+// stream calls a SETOF function and writes its rows, of type t,
+// as newline-delimited JSON
+func (h *Handler) stream(ctx context.Context, w http.ResponseWriter, t reflect.Type, schema string, proc string, params []interface{}) {
+	ch := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, t), 0)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- h.p.CallContext(ctx, ch.Interface(), schema, proc, params...)
+	}()
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(errc)},
+	}
+	var (
+		enc     = json.NewEncoder(w)
+		started bool
+	)
+	flusher, _ := w.(http.Flusher)
+	for {
+		chosen, row, ok := reflect.Select(cases)
+		if chosen == 0 {
+			if !ok {
+				// the channel is closed, wait for the result of the call
+				cases[0].Chan = reflect.Value{}
+				continue
+			}
+			if !started {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				started = true
+			}
+			enc.Encode(row.Interface())
+			if flusher != nil {
+				flusher.Flush()
+			}
+			continue
+		}
+		err, _ := row.Interface().(error)
+		if err != nil {
+			if !started {
+				writeError(w, err)
+				return
+			}
+			// the status is already sent, end the stream with the error
+			enc.Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		return
+	}
+}
+
+// parsePath returns the schema and the procedure of a /rpc/{schema}/{proc} path
+func parsePath(path string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "rpc" || parts[1] == "" || parts[2] == "" {
+		return "", "", errorf(http.StatusNotFound, "%s not found, use /rpc/{schema}/{proc}", path)
+	}
+	return parts[1], parts[2], nil
+}
+
+// args are the positional or named arguments of a call
+type args struct {
+	positional []json.RawMessage
+	named      map[string]json.RawMessage
+}
+
+// parseArgs parses the body of a request, a JSON array of positional
+// arguments or a JSON object of named arguments; an empty body means
+// no arguments
+func parseArgs(body []byte) (*args, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return &args{}, nil
+	}
+	var a args
+	var err error
+	switch body[0] {
+	case '[':
+		err = json.Unmarshal(body, &a.positional)
+	case '{':
+		err = json.Unmarshal(body, &a.named)
+	default:
+		err = errors.New("an array or an object is expected")
+	}
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid arguments: %s", err)
+	}
+	return &a, nil
+}
+
+func (a *args) len() int {
+	if a.named != nil {
+		return len(a.named)
+	}
+	return len(a.positional)
+}
+
+// selectFunction returns the overload accepting the arguments:
+// with as many input arguments, with the same names for named arguments
+func selectFunction(functions []pgproc.Function, call *args) (pgproc.Function, error) {
+	for _, fn := range functions {
+		if !fn.Accepts(call.len()) {
+			continue
+		}
+		found := true
+		for _, arg := range fn.InArgs() {
+			if _, ok := call.named[arg.Name]; call.named != nil && !ok {
+				found = false
+			}
+		}
+		if found {
+			return fn, nil
+		}
+	}
+	return pgproc.Function{}, errorf(http.StatusNotFound, "no function %s.%s accepting these arguments",
+		functions[0].Schema, functions[0].Name)
+}
+
+// params returns the parameters to give to Call for the arguments of fn
+func (a *args) params(fn pgproc.Function) ([]interface{}, error) {
+	var params []interface{}
+	for i, arg := range fn.InArgs() {
+		var raw json.RawMessage
+		if a.named != nil {
+			raw = a.named[arg.Name]
+		} else {
+			raw = a.positional[i]
+		}
+		param, err := decodeParam(raw, arg.Type)
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "argument %d (%s): %s", i+1, arg.Name, err)
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// decodeParam returns the parameter to give to Call for the JSON value raw,
+// for an argument of the PostgreSQL type typname
+func decodeParam(raw json.RawMessage, typname string) (interface{}, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	if typname == "json" || typname == "jsonb" {
+		return string(raw), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if err := checkParam(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// checkParam checks that v contains no objects
+func checkParam(v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return errors.New("objects are only accepted for json arguments")
+	case []interface{}:
+		for _, elem := range v {
+			if err := checkParam(elem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	rawJSONType = reflect.TypeOf(json.RawMessage(nil))
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// goType returns the Go type marshaled to JSON the values
+// of the PostgreSQL type typname are stored into
+func goType(typname string) reflect.Type {
+	switch typname {
+	case "bool":
+		return reflect.TypeOf(false)
+	case "int2", "int4", "int8", "oid":
+		return reflect.TypeOf(int64(0))
+	case "float4", "float8":
+		return reflect.TypeOf(float64(0))
+	case "numeric":
+		return reflect.TypeOf(json.Number(""))
+	case "json", "jsonb":
+		return rawJSONType
+	case "timestamp", "timestamptz":
+		return timeType
+	}
+	if len(typname) > 1 && typname[0] == '_' {
+		elem := goType(typname[1:])
+		if elem == rawJSONType || elem.Kind() == reflect.Slice {
+			elem = reflect.TypeOf("")
+		}
+		return reflect.SliceOf(elem)
+	}
+	// other values are returned in their textual form
+	return reflect.TypeOf("")
+}
+
+// valueType returns the type of a nullable value of the PostgreSQL type typname
+func valueType(typname string) reflect.Type {
+	t := goType(typname)
+	if t.Kind() == reflect.Slice {
+		// a nil slice is marshaled as null
+		return t
+	}
+	return reflect.PtrTo(t)
+}
+
+// resultType returns the Go type the result, or the rows of a SETOF result,
+// are stored into: a struct for a composite result or OUT arguments
+func resultType(result pgproc.Result) reflect.Type {
+	if len(result.Fields) == 0 {
+		return valueType(result.Type)
+	}
+	var (
+		fields []reflect.StructField
+		names  = map[string]bool{}
+	)
+	for i, field := range result.Fields {
+		// pgproc looks for the struct fields by name then by tag,
+		// the field is named after the attribute when possible
+		name := strings.Title(field.Name)
+		if !isExportedIdentifier(name) || names[name] {
+			name = fmt.Sprintf("Field%d", i)
+		}
+		for names[name] {
+			name += "_"
+		}
+		names[name] = true
+		fields = append(fields, reflect.StructField{
+			Name: name,
+			Type: valueType(field.Type),
+			Tag:  reflect.StructTag(fmt.Sprintf(`pgproc:%q json:%q`, field.Name, field.Name)),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+// isExportedIdentifier returns true if name is an exported Go identifier
+func isExportedIdentifier(name string) bool {
+	for i, r := range name {
+		if i == 0 && !(r >= 'A' && r <= 'Z') {
+			return false
+		}
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// writeError writes err as a JSON object, with a status depending on err
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var (
+		herr *httpError
+		perr *pq.Error
+	)
+	switch {
+	case errors.As(err, &herr):
+		status = herr.status
+	case errors.Is(err, pgproc.ErrNotCallable):
+		status = http.StatusForbidden
+	case errors.As(err, &perr):
+		// invalid data and exceptions raised by the procedures
+		// are errors of the client
+		if class := perr.Code.Class(); class == "22" || class == "23" || perr.Code == "P0001" {
+			status = http.StatusBadRequest
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,166 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/feloy/pgproc"
+)
+
+const conninfo = "user=pgproctest password=pgproctest host=localhost dbname=pgproctest sslmode=disable"
+
+func TestParsePath(t *testing.T) {
+	schema, proc, err := parsePath("/rpc/tests/content_get")
+	if err != nil || schema != "tests" || proc != "content_get" {
+		t.Errorf("Error parsing path: %s %s %v", schema, proc, err)
+	}
+	for _, path := range []string{"/rpc/tests", "/rpc//content_get", "/api/tests/content_get", "/rpc/tests/content_get/1"} {
+		if _, _, err := parsePath(path); err == nil {
+			t.Errorf("Error expected parsing %s", path)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	for body, n := range map[string]int{"": 0, " [] ": 0, `[1, "a"]`: 2, `{"prm_id": 1}`: 1} {
+		a, err := parseArgs([]byte(body))
+		if err != nil || a.len() != n {
+			t.Errorf("Error parsing %q: %v", body, err)
+		}
+	}
+	for _, body := range []string{"1", `"a"`, "[1,", `{"a": }`} {
+		if _, err := parseArgs([]byte(body)); err == nil {
+			t.Errorf("Error expected parsing %q", body)
+		}
+	}
+}
+
+func TestSelectFunction(t *testing.T) {
+	functions := []pgproc.Function{
+		{Schema: "tests", Name: "f", Args: []pgproc.Argument{{Name: "a", Type: "int4", Mode: "in"}, {Name: "r", Type: "int4", Mode: "out"}}},
+		{Schema: "tests", Name: "f", Args: []pgproc.Argument{{Name: "a", Type: "int4", Mode: "in"}, {Name: "b", Type: "text", Mode: "in"}}},
+	}
+	for body, expected := range map[string]int{`[1]`: 1, `{"a": 1}`: 1, `[1, "b"]`: 2, `{"b": "b", "a": 1}`: 2} {
+		a, _ := parseArgs([]byte(body))
+		fn, err := selectFunction(functions, a)
+		if err != nil || len(fn.InArgs()) != expected {
+			t.Errorf("Error selecting function for %s: %v", body, err)
+		}
+	}
+	for _, body := range []string{`[]`, `{"b": 1}`, `[1, 2, 3]`} {
+		a, _ := parseArgs([]byte(body))
+		if _, err := selectFunction(functions, a); err == nil {
+			t.Errorf("Error expected selecting function for %s", body)
+		}
+	}
+}
+
+func TestDecodeParam(t *testing.T) {
+	for raw, expected := range map[string]interface{}{
+		`null`:     nil,
+		`1.5`:      json.Number("1.5"),
+		`"a"`:      "a",
+		`[1, 2]`:   []interface{}{json.Number("1"), json.Number("2")},
+		`{"a": 1}`: `{"a": 1}`,
+		`true`:     true,
+	} {
+		typname := "text"
+		if strings.HasPrefix(raw, "{") {
+			typname = "jsonb"
+		}
+		param, err := decodeParam(json.RawMessage(raw), typname)
+		if err != nil || !reflect.DeepEqual(param, expected) {
+			t.Errorf("Error decoding %s: %#v %v", raw, param, err)
+		}
+	}
+	if _, err := decodeParam(json.RawMessage(`{"a": 1}`), "int4"); err == nil {
+		t.Errorf("Error expected decoding an object for int4")
+	}
+}
+
+func TestResultType(t *testing.T) {
+	if rt := resultType(pgproc.Result{Type: "int4"}); rt != reflect.TypeOf((*int64)(nil)) {
+		t.Errorf("Error result type for int4: %s", rt)
+	}
+	if rt := resultType(pgproc.Result{Type: "_text"}); rt != reflect.TypeOf([]string(nil)) {
+		t.Errorf("Error result type for _text: %s", rt)
+	}
+	rt := resultType(pgproc.Result{Type: "content", Fields: []pgproc.Field{
+		{Name: "cnt_id", Type: "int4"}, {Name: "cnt name", Type: "text"}, {Name: "Cnt_id", Type: "bool"},
+	}})
+	var names []string
+	for i := 0; i < rt.NumField(); i++ {
+		names = append(names, rt.Field(i).Name+" "+rt.Field(i).Tag.Get("json"))
+	}
+	if strings.Join(names, ",") != "Cnt_id cnt_id,Field1 cnt name,Field2 Cnt_id" {
+		t.Errorf("Error result fields: %v", names)
+	}
+	rt = resultType(pgproc.Result{Type: "record", Fields: []pgproc.Field{{Name: "c", Type: "int4"}}})
+	if rt.Kind() != reflect.Struct || rt.Field(0).Type != reflect.TypeOf((*int64)(nil)) {
+		t.Errorf("Error result type for record: %s", rt)
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeResult(w, map[string]int{"a": 1})
+	if w.Code != 200 || w.Body.String() != `{"a":1}`+"\n" {
+		t.Errorf("Error writing result: %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	number := json.Number("NaN")
+	writeResult(w, &number)
+	if w.Code != 500 || !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("Error expected error writing NaN: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	p, err := pgproc.NewPgProc(conninfo)
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	h := NewHandler(p)
+	for _, c := range []struct {
+		method, path, body string
+		status             int
+		response           string
+	}{
+		{"POST", "/rpc/tests/test_returns_incremented_integer", `[41]`, 200, "42\n"},
+		{"POST", "/rpc/tests/test_returns_incremented_integer", `{"n": 41}`, 200, "42\n"},
+		{"POST", "/rpc/tests/test_returns_composite", ``, 200, `{"a":1,"b":"hello"}` + "\n"},
+		{"POST", "/rpc/tests/test_returns_setof_integer", ``, 200, "42\n43\n44\n"},
+		{"POST", "/rpc/tests/test_described", `[41, "hello"]`, 200, `{"c":42,"d":"hello"}` + "\n"},
+		{"POST", "/rpc/tests/test_returns_incremented_integer", `{"m": 41}`, 404, ""},
+		{"POST", "/rpc/tests/unknown_function", ``, 404, ""},
+		{"POST", "/rpc/tests/_hidden_function", ``, 403, ""},
+		{"POST", "/rpc/tests/function_raising_exception", ``, 400, ""},
+		{"POST", "/rpc/tests/test_returns_incremented_integer", `[true]`, 400, ""},
+		{"GET", "/rpc/tests/test_returns_integer", ``, 405, ""},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+		if w.Code != c.status {
+			t.Errorf("Error status of %s %s: %d %s", c.path, c.body, w.Code, w.Body)
+		}
+		if c.response != "" && w.Body.String() != c.response {
+			t.Errorf("Error response of %s %s: %s", c.path, c.body, w.Body)
+		}
+	}
+}
+
+func TestHandlerStreamsContentType(t *testing.T) {
+	p, err := pgproc.NewPgProc(conninfo)
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	w := httptest.NewRecorder()
+	NewHandler(p).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rpc/tests/test_returns_setof_string", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Error content type: %s", ct)
+	}
+}
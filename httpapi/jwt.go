@@ -0,0 +1,171 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWTConfig configures the validation of the bearer tokens of the requests,
+// and the mapping of their claims to the session of the calls
+type JWTConfig struct {
+	// Key verifies the signatures of the tokens: a []byte secret
+	// for HS256, HS384 and HS512, or an *rsa.PublicKey for RS256,
+	// RS384 and RS512
+	Key interface{}
+	// RoleClaim is the claim giving the role the calls are done under
+	// (SET LOCAL ROLE), "role" by default; the calls are done under
+	// AnonymousRole if the claim is absent
+	RoleClaim string
+	// AnonymousRole is the role of the requests without a bearer token
+	// or without a role claim, which are rejected if empty
+	AnonymousRole string
+	// ClaimsSetting is the configuration parameter the claims are set into,
+	// as a JSON object, "request.claims" by default
+	ClaimsSetting string
+}
+
+// SetJWT makes the handler validate the bearer tokens of the requests, and
+// do each call in a transaction under the role given by the token, with
+// its claims available to the procedures and row-level security policies
+// with current_setting('request.claims').
+// SetJWT must be called before the handler is used.
+func (h *Handler) SetJWT(config JWTConfig) {
+	if config.RoleClaim == "" {
+		config.RoleClaim = "role"
+	}
+	if config.ClaimsSetting == "" {
+		config.ClaimsSetting = "request.claims"
+	}
+	h.jwt = &config
+}
+
+// session returns the role and the settings of the session of a request
+func (c *JWTConfig) session(r *http.Request) (string, map[string]string, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		if c.AnonymousRole == "" {
+			return "", nil, errorf(http.StatusUnauthorized, "missing bearer token")
+		}
+		return c.AnonymousRole, nil, nil
+	}
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", nil, errorf(http.StatusUnauthorized, "invalid authorization scheme")
+	}
+	payload, err := c.verify(auth[len(prefix):], time.Now())
+	if err != nil {
+		return "", nil, errorf(http.StatusUnauthorized, "invalid token: %s", err)
+	}
+	var claims map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return "", nil, errorf(http.StatusUnauthorized, "invalid token claims: %s", err)
+	}
+	v, found := claims[c.RoleClaim]
+	if !found {
+		// the calls are never done under the role of the connection
+		if c.AnonymousRole == "" {
+			return "", nil, errorf(http.StatusUnauthorized, "missing %s claim", c.RoleClaim)
+		}
+		return c.AnonymousRole, map[string]string{c.ClaimsSetting: string(payload)}, nil
+	}
+	role, _ := v.(string)
+	if role == "" {
+		return "", nil, errorf(http.StatusUnauthorized, "invalid %s claim", c.RoleClaim)
+	}
+	return role, map[string]string{c.ClaimsSetting: string(payload)}, nil
+}
+
+// signingHashes are the hashes of the supported algorithms
+var signingHashes = map[string]crypto.Hash{
+	"HS256": crypto.SHA256,
+	"HS384": crypto.SHA384,
+	"HS512": crypto.SHA512,
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// verify verifies the signature and the validity period of the JWT token
+// at now, and returns its payload
+func (c *JWTConfig) verify(token string, now time.Time) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	hash, found := signingHashes[header.Alg]
+	if !found {
+		return nil, fmt.Errorf("unsupported algorithm %s", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch key := c.Key.(type) {
+	case []byte:
+		if header.Alg[0] != 'H' {
+			return nil, fmt.Errorf("algorithm %s does not match the key", header.Alg)
+		}
+		mac := hmac.New(hash.New, key)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if header.Alg[0] != 'R' {
+			return nil, fmt.Errorf("algorithm %s does not match the key", header.Alg)
+		}
+		h := hash.New()
+		h.Write(signed)
+		if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+			return nil, errors.New("invalid signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", c.Key)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var period struct {
+		Exp *float64 `json:"exp"`
+		Nbf *float64 `json:"nbf"`
+	}
+	if err := json.Unmarshal(payload, &period); err != nil {
+		return nil, err
+	}
+	if period.Exp != nil && now.Unix() >= int64(*period.Exp) {
+		return nil, errors.New("token expired")
+	}
+	if period.Nbf != nil && now.Unix() < int64(*period.Nbf) {
+		return nil, errors.New("token not valid yet")
+	}
+	return payload, nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
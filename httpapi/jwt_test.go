@@ -0,0 +1,106 @@
+package httpapi
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// token returns a JWT token with the claims, signed with key
+func token(alg string, claims string, key interface{}) string {
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"`+alg+`","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims))
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		h := sha256.Sum256([]byte(signed))
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	}
+	return signed + "." + enc.EncodeToString(signature)
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	secret := []byte("secret")
+	c := JWTConfig{Key: secret}
+	now := time.Unix(1000, 0)
+	if _, err := c.verify(token("HS256", `{"role":"web","exp":2000}`, secret), now); err != nil {
+		t.Errorf("Error verifying valid token: %s", err)
+	}
+	for name, tok := range map[string]string{
+		"expired":         token("HS256", `{"exp":1000}`, secret),
+		"not valid yet":   token("HS256", `{"nbf":1001}`, secret),
+		"wrong secret":    token("HS256", `{}`, []byte("other")),
+		"none algorithm":  token("none", `{}`, secret),
+		"malformed":       "abc.def",
+		"wrong algorithm": token("RS256", `{}`, secret),
+	} {
+		if _, err := c.verify(tok, now); err == nil {
+			t.Errorf("Error expected verifying %s token", name)
+		}
+	}
+}
+
+func TestVerifyRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := JWTConfig{Key: &key.PublicKey}
+	if _, err := c.verify(token("RS256", `{"role":"web"}`, key), time.Now()); err != nil {
+		t.Errorf("Error verifying valid token: %s", err)
+	}
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := c.verify(token("RS256", `{"role":"web"}`, other), time.Now()); err == nil {
+		t.Errorf("Error expected verifying token signed with another key")
+	}
+}
+
+func TestSession(t *testing.T) {
+	secret := []byte("secret")
+	h := NewHandler(nil)
+	h.SetJWT(JWTConfig{Key: secret, AnonymousRole: "anon"})
+
+	r := httptest.NewRequest("POST", "/rpc/tests/f", nil)
+	role, settings, err := h.jwt.session(r)
+	if err != nil || role != "anon" || settings != nil {
+		t.Errorf("Error anonymous session: %s %v %v", role, settings, err)
+	}
+
+	claims := `{"role":"web","sub":"42"}`
+	r.Header.Set("Authorization", "Bearer "+token("HS256", claims, secret))
+	role, settings, err = h.jwt.session(r)
+	if err != nil || role != "web" || settings["request.claims"] != claims {
+		t.Errorf("Error session: %s %v %v", role, settings, err)
+	}
+
+	r.Header.Set("Authorization", "Bearer "+token("HS256", `{"role":42}`, secret))
+	if _, _, err := h.jwt.session(r); err == nil {
+		t.Errorf("Error expected invalid role claim")
+	}
+
+	claims = `{"sub":"42"}`
+	r.Header.Set("Authorization", "Bearer "+token("HS256", claims, secret))
+	role, settings, err = h.jwt.session(r)
+	if err != nil || role != "anon" || settings["request.claims"] != claims {
+		t.Errorf("Error session without role claim: %s %v %v", role, settings, err)
+	}
+
+	h.SetJWT(JWTConfig{Key: secret})
+	if _, _, err := h.jwt.session(r); err == nil {
+		t.Errorf("Error expected missing role claim")
+	}
+	r.Header.Del("Authorization")
+	if _, _, err := h.jwt.session(r); err == nil {
+		t.Errorf("Error expected missing token")
+	}
+}
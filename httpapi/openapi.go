@@ -0,0 +1,235 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/feloy/pgproc"
+)
+
+// object is a JSON object of the OpenAPI document
+type object = map[string]interface{}
+
+// OpenAPI returns an OpenAPI 3 document describing the callable functions
+// of the schemas as operations of the gateway, with the schemas of their
+// arguments and results derived from the catalog, and their description
+// from their comment (COMMENT ON FUNCTION)
+func OpenAPI(ctx context.Context, p *pgproc.PgProc, schemas ...string) ([]byte, error) {
+	var (
+		functions []pgproc.Function
+		enums     = map[string][]string{}
+	)
+	for _, schema := range schemas {
+		list, err := p.ListFunctions(schema)
+		if err != nil {
+			return nil, err
+		}
+		for _, fn := range list {
+			if p.Callable(ctx, fn.Schema, fn.Name, len(fn.InArgs())) == nil {
+				functions = append(functions, fn)
+			}
+		}
+		schemaEnums, err := p.ListEnums(schema)
+		if err != nil {
+			return nil, err
+		}
+		for name, labels := range schemaEnums {
+			enums[schema+"."+name] = labels
+		}
+	}
+	return json.MarshalIndent(openAPI(functions, enums), "", "  ")
+}
+
+// OpenAPIHandler returns an http.Handler serving the OpenAPI document
+// of the functions of the schemas, as returned by OpenAPI
+func (h *Handler) OpenAPIHandler(schemas ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, err := OpenAPI(r.Context(), h.p, schemas...)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	})
+}
+
+// openAPI returns the OpenAPI document of the functions, enums giving
+// the labels of the enum types by schema-qualified name
+func openAPI(functions []pgproc.Function, enums map[string][]string) object {
+	d := &document{enums: enums, components: object{
+		"Error": object{
+			"type":       "object",
+			"properties": object{"error": object{"type": "string"}},
+		},
+	}}
+	paths := object{}
+	overloads := map[string][]pgproc.Function{}
+	var order []string
+	for _, fn := range functions {
+		path := "/rpc/" + fn.Schema + "/" + fn.Name
+		if overloads[path] == nil {
+			order = append(order, path)
+		}
+		overloads[path] = append(overloads[path], fn)
+	}
+	for _, path := range order {
+		paths[path] = object{"post": d.operation(overloads[path])}
+	}
+	return object{
+		"openapi":    "3.0.3",
+		"info":       object{"title": "pgproc API", "version": "1.0.0"},
+		"paths":      paths,
+		"components": object{"schemas": d.components},
+	}
+}
+
+// document holds the components of an OpenAPI document being built
+type document struct {
+	enums      map[string][]string
+	components object
+}
+
+// operation returns the operation calling a function, with its overloads
+func (d *document) operation(overloads []pgproc.Function) object {
+	fn := overloads[0]
+	op := object{"operationId": fn.Schema + "." + fn.Name}
+	if fn.Comment != "" {
+		op["summary"] = strings.SplitN(fn.Comment, "\n", 2)[0]
+		op["description"] = fn.Comment
+	}
+
+	var bodies, results []interface{}
+	void, setof := true, false
+	for _, fn := range overloads {
+		bodies = append(bodies, d.arguments(fn))
+		if fn.Result.Type != "void" {
+			void = false
+			setof = setof || fn.Result.Setof
+			results = append(results, d.result(fn.Schema, fn.Result))
+		}
+	}
+	op["requestBody"] = object{
+		"required": false,
+		"content":  object{"application/json": object{"schema": oneOf(bodies)}},
+	}
+
+	responses := object{
+		"default": object{
+			"description": "Error",
+			"content":     object{"application/json": object{"schema": ref("Error")}},
+		},
+	}
+	switch {
+	case void:
+		responses["204"] = object{"description": "The function returns no result"}
+	case setof:
+		responses["200"] = object{
+			"description": "The rows returned by the function, one JSON value per line",
+			"content":     object{"application/x-ndjson": object{"schema": oneOf(results)}},
+		}
+	default:
+		responses["200"] = object{
+			"description": "The result of the function",
+			"content":     object{"application/json": object{"schema": oneOf(results)}},
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// arguments returns the schema of the body of a call to fn: an object
+// of named arguments, or an array if some arguments have no name.
+// All the arguments are required, the gateway calling the function
+// with as many arguments as given, defaulted ones included
+func (d *document) arguments(fn pgproc.Function) object {
+	in := fn.InArgs()
+	properties := object{}
+	var required []string
+	for _, arg := range in {
+		schema := d.schema(fn.Schema, arg.Type)
+		if arg.Name == "" {
+			return object{"type": "array", "minItems": len(in), "maxItems": len(in)}
+		}
+		properties[arg.Name] = schema
+		required = append(required, arg.Name)
+	}
+	o := object{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		o["required"] = required
+	}
+	return o
+}
+
+// result returns the schema of the result, or of a row of the result,
+// of a function of schema: a component for a composite type, an inline
+// object for OUT arguments
+func (d *document) result(schema string, result pgproc.Result) object {
+	if len(result.Fields) == 0 {
+		return d.schema(schema, result.Type)
+	}
+	properties := object{}
+	for _, field := range result.Fields {
+		properties[field.Name] = d.schema(schema, field.Type)
+	}
+	if result.Type == "record" {
+		return object{"type": "object", "properties": properties}
+	}
+	name := schema + "." + result.Type
+	if _, found := d.components[name]; !found {
+		d.components[name] = object{"type": "object", "properties": properties}
+	}
+	return ref(name)
+}
+
+// schema returns the JSON schema of the values of the PostgreSQL type typname,
+// used by a function of schema. Components are named after the schema for
+// the types of different schemas not to collide
+func (d *document) schema(schema string, typname string) object {
+	switch typname {
+	case "bool":
+		return object{"type": "boolean"}
+	case "int2", "int4":
+		return object{"type": "integer", "format": "int32"}
+	case "int8", "oid":
+		return object{"type": "integer", "format": "int64"}
+	case "float4":
+		return object{"type": "number", "format": "float"}
+	case "float8":
+		return object{"type": "number", "format": "double"}
+	case "numeric":
+		return object{"type": "number"}
+	case "json", "jsonb":
+		return object{}
+	case "date", "timestamp", "timestamptz":
+		// dates are written as timestamps, in RFC 3339 format
+		return object{"type": "string", "format": "date-time"}
+	case "uuid":
+		return object{"type": "string", "format": "uuid"}
+	}
+	if len(typname) > 1 && typname[0] == '_' {
+		return object{"type": "array", "items": d.schema(schema, typname[1:])}
+	}
+	name := schema + "." + typname
+	if labels, found := d.enums[name]; found {
+		if _, found := d.components[name]; !found {
+			d.components[name] = object{"type": "string", "enum": labels}
+		}
+		return ref(name)
+	}
+	return object{"type": "string"}
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// oneOf returns the only schema of schemas, or a oneOf schema
+func oneOf(schemas []interface{}) interface{} {
+	if len(schemas) == 1 {
+		return schemas[0]
+	}
+	return object{"oneOf": schemas}
+}
@@ -0,0 +1,127 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/feloy/pgproc"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	functions := []pgproc.Function{
+		{Schema: "tests", Name: "content_get", Comment: "Returns a content\nby its id",
+			Args: []pgproc.Argument{{Name: "prm_id", Type: "int4", Mode: "in"}},
+			Result: pgproc.Result{Type: "content", Fields: []pgproc.Field{
+				{Name: "cnt_id", Type: "int4"}, {Name: "cnt_name", Type: "text"}}}},
+		{Schema: "tests", Name: "test_enum_arg",
+			Args:   []pgproc.Argument{{Name: "enumval", Type: "enumtype", Mode: "in", Default: "'val1'::tests.enumtype"}},
+			Result: pgproc.Result{Type: "enumtype", Setof: true}},
+		{Schema: "tests", Name: "content_touch",
+			Args:   []pgproc.Argument{{Type: "date", Mode: "in"}},
+			Result: pgproc.Result{Type: "void"}},
+		{Schema: "other", Name: "content_get",
+			Args:   []pgproc.Argument{{Name: "at", Type: "date", Mode: "in"}, {Name: "c", Type: "int4", Mode: "out"}},
+			Result: pgproc.Result{Type: "record", Fields: []pgproc.Field{{Name: "c", Type: "int4"}}}},
+		{Schema: "other", Name: "error_get",
+			Result: pgproc.Result{Type: "Error", Fields: []pgproc.Field{{Name: "code", Type: "int4"}}}},
+	}
+	doc := openAPI(functions, map[string][]string{"tests.enumtype": {"val1", "val2"}})
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Error marshaling: %s", err)
+	}
+	var d struct {
+		Paths map[string]struct {
+			Post struct {
+				OperationID string `json:"operationId"`
+				Summary     string
+				RequestBody struct {
+					Content map[string]struct{ Schema map[string]interface{} }
+				}
+				Responses map[string]struct {
+					Content map[string]struct{ Schema map[string]interface{} }
+				}
+			}
+		}
+		Components struct {
+			Schemas map[string]map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("Error unmarshaling: %s", err)
+	}
+
+	get := d.Paths["/rpc/tests/content_get"].Post
+	if get.OperationID != "tests.content_get" || get.Summary != "Returns a content" {
+		t.Errorf("Error in operation: %+v", get)
+	}
+	body := get.RequestBody.Content["application/json"].Schema
+	if !reflect.DeepEqual(body["required"], []interface{}{"prm_id"}) {
+		t.Errorf("Error in request body: %v", body)
+	}
+	if ref := get.Responses["200"].Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/tests.content" {
+		t.Errorf("Error in response: %v", get.Responses)
+	}
+	if d.Components.Schemas["tests.content"]["type"] != "object" {
+		t.Errorf("Error in content component: %v", d.Components.Schemas)
+	}
+
+	enum := d.Paths["/rpc/tests/test_enum_arg"].Post
+	if _, found := enum.Responses["200"].Content["application/x-ndjson"]; !found {
+		t.Errorf("Error expected ndjson response: %v", enum.Responses)
+	}
+	if !reflect.DeepEqual(enum.RequestBody.Content["application/json"].Schema["required"], []interface{}{"enumval"}) {
+		t.Errorf("Error expected required argument with default")
+	}
+	if !reflect.DeepEqual(d.Components.Schemas["tests.enumtype"]["enum"], []interface{}{"val1", "val2"}) {
+		t.Errorf("Error in enum component: %v", d.Components.Schemas)
+	}
+
+	touch := d.Paths["/rpc/tests/content_touch"].Post
+	if _, found := touch.Responses["204"]; !found {
+		t.Errorf("Error expected 204 response: %v", touch.Responses)
+	}
+	if touch.RequestBody.Content["application/json"].Schema["type"] != "array" {
+		t.Errorf("Error expected array of unnamed arguments")
+	}
+
+	out := d.Paths["/rpc/other/content_get"].Post
+	body = out.RequestBody.Content["application/json"].Schema
+	at := body["properties"].(map[string]interface{})["at"]
+	if !reflect.DeepEqual(at, map[string]interface{}{"type": "string", "format": "date-time"}) {
+		t.Errorf("Error in date argument: %v", body)
+	}
+	if out.Responses["200"].Content["application/json"].Schema["type"] != "object" {
+		t.Errorf("Error expected object for OUT arguments: %v", out.Responses)
+	}
+	if _, found := d.Components.Schemas["other.Error"]; !found || d.Components.Schemas["Error"]["properties"] == nil {
+		t.Errorf("Error in components: %v", d.Components.Schemas)
+	}
+	errorProperties := d.Components.Schemas["Error"]["properties"].(map[string]interface{})
+	if _, found := errorProperties["error"]; !found {
+		t.Errorf("Error component overwritten: %v", d.Components.Schemas["Error"])
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	p, err := pgproc.NewPgProc(conninfo)
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	data, err := OpenAPI(context.Background(), p, "tests")
+	if err != nil {
+		t.Fatalf("Error generating document: %s", err)
+	}
+	var d struct{ Paths map[string]interface{} }
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("Error unmarshaling: %s", err)
+	}
+	if _, found := d.Paths["/rpc/tests/content_get"]; !found {
+		t.Errorf("Error content_get not described")
+	}
+	if _, found := d.Paths["/rpc/tests/_hidden_function"]; found {
+		t.Errorf("Error hidden function described")
+	}
+}
@@ -0,0 +1,200 @@
+package pgproc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// LatencyBuckets are the upper bounds of the buckets of the latency histograms
+var LatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// FunctionStats are the statistics of the calls of a procedure, or of
+// the procedures not found, under the unknown schema and procedure
+type FunctionStats struct {
+	Schema string
+	Proc   string
+	Calls  int64
+	// Errors counts the failed calls by SQLSTATE, the empty code
+	// counting the errors not returned by PostgreSQL
+	Errors map[string]int64
+	// Rows is the number of rows returned
+	Rows int64
+	// Batch tells if the calls were run in batches, their latency
+	// being the one of the batch
+	Batch   bool
+	Latency Histogram
+}
+
+// Histogram is a histogram of the latencies of the calls
+type Histogram struct {
+	// Counts are the numbers of calls with a latency lower than or equal to
+	// each bound of LatencyBuckets, the last count being for greater latencies
+	Counts []int64
+	Sum    time.Duration
+}
+
+// metrics records the statistics of the calls
+type metrics struct {
+	mu    sync.Mutex
+	stats map[statsKey]*FunctionStats
+}
+
+// statsKey identifies the statistics of a procedure
+type statsKey struct {
+	schema string
+	proc   string
+	batch  bool
+}
+
+// unknownProc labels the calls of procedures not found in the catalog,
+// for the names given by the callers not to be unbounded labels
+const unknownProc = "unknown"
+
+// record records a call, run in a batch if batch is true
+func (m *metrics) record(inv *Invocation, batch bool, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stats == nil {
+		m.stats = map[statsKey]*FunctionStats{}
+	}
+	key := statsKey{schema: unknownProc, proc: unknownProc, batch: batch}
+	if inv.rt != nil {
+		key.schema, key.proc = inv.Schema, inv.Proc
+	}
+	s := m.stats[key]
+	if s == nil {
+		s = &FunctionStats{
+			Schema:  key.schema,
+			Proc:    key.proc,
+			Batch:   key.batch,
+			Errors:  map[string]int64{},
+			Latency: Histogram{Counts: make([]int64, len(LatencyBuckets)+1)},
+		}
+		m.stats[key] = s
+	}
+	s.Calls++
+	s.Rows += int64(inv.Rows)
+	if err != nil {
+		s.Errors[sqlState(err)]++
+	}
+	bucket := sort.Search(len(LatencyBuckets), func(i int) bool { return latency <= LatencyBuckets[i] })
+	s.Latency.Counts[bucket]++
+	s.Latency.Sum += latency
+}
+
+// sqlState returns the SQLSTATE of err, empty if not returned by PostgreSQL
+func sqlState(err error) string {
+	var perr *pq.Error
+	if errors.As(err, &perr) {
+		return string(perr.Code)
+	}
+	return ""
+}
+
+// Stats returns a snapshot of the statistics of the calls,
+// ordered by schema and procedure
+func (p *PgProc) Stats() []FunctionStats {
+	p.metrics.mu.Lock()
+	defer p.metrics.mu.Unlock()
+	stats := make([]FunctionStats, 0, len(p.metrics.stats))
+	for _, s := range p.metrics.stats {
+		snapshot := *s
+		snapshot.Errors = map[string]int64{}
+		for code, n := range s.Errors {
+			snapshot.Errors[code] = n
+		}
+		snapshot.Latency.Counts = append([]int64(nil), s.Latency.Counts...)
+		stats = append(stats, snapshot)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Schema != stats[j].Schema {
+			return stats[i].Schema < stats[j].Schema
+		}
+		if stats[i].Proc != stats[j].Proc {
+			return stats[i].Proc < stats[j].Proc
+		}
+		return !stats[i].Batch && stats[j].Batch
+	})
+	return stats
+}
+
+// MetricsHandler returns an http.Handler serving the statistics of the calls
+// in the Prometheus text format
+func (p *PgProc) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, p.Stats())
+	})
+}
+
+// writeMetrics writes the statistics in the Prometheus text format
+func writeMetrics(w io.Writer, stats []FunctionStats) {
+	fmt.Fprintln(w, "# HELP pgproc_calls_total Number of calls of the procedures.")
+	fmt.Fprintln(w, "# TYPE pgproc_calls_total counter")
+	for _, s := range stats {
+		fmt.Fprintf(w, "pgproc_calls_total{%s} %d\n", labels(s), s.Calls)
+	}
+	fmt.Fprintln(w, "# HELP pgproc_errors_total Number of failed calls of the procedures, by SQLSTATE.")
+	fmt.Fprintln(w, "# TYPE pgproc_errors_total counter")
+	for _, s := range stats {
+		codes := make([]string, 0, len(s.Errors))
+		for code := range s.Errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "pgproc_errors_total{%s,sqlstate=%s} %d\n", labels(s), quoteLabel(code), s.Errors[code])
+		}
+	}
+	fmt.Fprintln(w, "# HELP pgproc_rows_total Number of rows returned by the procedures.")
+	fmt.Fprintln(w, "# TYPE pgproc_rows_total counter")
+	for _, s := range stats {
+		fmt.Fprintf(w, "pgproc_rows_total{%s} %d\n", labels(s), s.Rows)
+	}
+	fmt.Fprintln(w, "# HELP pgproc_call_duration_seconds Latency of the calls of the procedures.")
+	fmt.Fprintln(w, "# TYPE pgproc_call_duration_seconds histogram")
+	for _, s := range stats {
+		var cumulative int64
+		for i, count := range s.Latency.Counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(LatencyBuckets) {
+				le = strconv.FormatFloat(LatencyBuckets[i].Seconds(), 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "pgproc_call_duration_seconds_bucket{%s,le=%q} %d\n", labels(s), le, cumulative)
+		}
+		fmt.Fprintf(w, "pgproc_call_duration_seconds_sum{%s} %s\n", labels(s),
+			strconv.FormatFloat(s.Latency.Sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(w, "pgproc_call_duration_seconds_count{%s} %d\n", labels(s), s.Calls)
+	}
+}
+
+// labels returns the labels identifying the procedure of s, and the
+// batch label for the calls run in batches
+func labels(s FunctionStats) string {
+	l := "schema=" + quoteLabel(s.Schema) + ",proc=" + quoteLabel(s.Proc)
+	if s.Batch {
+		l += `,batch="true"`
+	}
+	return l
+}
+
+// quoteLabel quotes a label value, escaping backslashes, quotes and newlines
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
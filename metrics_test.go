@@ -0,0 +1,97 @@
+package pgproc
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestRecordMetrics(t *testing.T) {
+	var p PgProc
+	inv := &Invocation{Schema: "tests", Proc: "content_list", Rows: 3, rt: &returnType{}}
+	p.metrics.record(inv, false, 2*time.Millisecond, nil)
+	p.metrics.record(inv, false, 20*time.Second, &pq.Error{Code: "40001"})
+	p.metrics.record(&Invocation{Schema: "tests", Proc: "content_get", rt: &returnType{}}, false, time.Millisecond, errors.New("not found"))
+
+	stats := p.Stats()
+	if len(stats) != 2 || stats[0].Proc != "content_get" || stats[1].Proc != "content_list" {
+		t.Fatalf("Error in stats: %+v", stats)
+	}
+	s := stats[1]
+	if s.Calls != 2 || s.Rows != 6 || s.Errors["40001"] != 1 || s.Latency.Sum != 20002*time.Millisecond {
+		t.Errorf("Error in stats: %+v", s)
+	}
+	if s.Latency.Counts[1] != 1 || s.Latency.Counts[len(LatencyBuckets)] != 1 {
+		t.Errorf("Error in latency histogram: %v", s.Latency.Counts)
+	}
+	if stats[0].Errors[""] != 1 || stats[0].Latency.Counts[0] != 1 {
+		t.Errorf("Error in stats: %+v", stats[0])
+	}
+
+	// the snapshot is not modified by later calls
+	p.metrics.record(inv, false, time.Millisecond, nil)
+	if s.Calls != 2 || s.Latency.Counts[0] != 0 {
+		t.Errorf("Error snapshot modified: %+v", s)
+	}
+}
+
+func TestRecordMetricsUnknown(t *testing.T) {
+	var p PgProc
+	p.metrics.record(&Invocation{Schema: "tests", Proc: "unknown_function"}, false, time.Millisecond, errors.New("not found"))
+	p.metrics.record(&Invocation{Schema: "tests", Proc: "other_function"}, false, time.Millisecond, errors.New("not found"))
+	stats := p.Stats()
+	if len(stats) != 1 || stats[0].Schema != "unknown" || stats[0].Proc != "unknown" || stats[0].Calls != 2 {
+		t.Errorf("Error in stats: %+v", stats)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	var p PgProc
+	p.metrics.record(&Invocation{Schema: "tests", Proc: `a"b`, Rows: 1, rt: &returnType{}}, false, 2*time.Millisecond, &pq.Error{Code: "40P01"})
+	p.metrics.record(&Invocation{Schema: "tests", Proc: `a"b`, rt: &returnType{}}, true, 2*time.Millisecond, nil)
+	w := httptest.NewRecorder()
+	p.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		`pgproc_calls_total{schema="tests",proc="a\"b"} 1`,
+		`pgproc_errors_total{schema="tests",proc="a\"b",sqlstate="40P01"} 1`,
+		`pgproc_rows_total{schema="tests",proc="a\"b"} 1`,
+		`pgproc_call_duration_seconds_bucket{schema="tests",proc="a\"b",le="0.001"} 0`,
+		`pgproc_call_duration_seconds_bucket{schema="tests",proc="a\"b",le="0.005"} 1`,
+		`pgproc_call_duration_seconds_bucket{schema="tests",proc="a\"b",le="+Inf"} 1`,
+		`pgproc_call_duration_seconds_sum{schema="tests",proc="a\"b"} 0.002`,
+		`pgproc_call_duration_seconds_count{schema="tests",proc="a\"b"} 1`,
+		`pgproc_calls_total{schema="tests",proc="a\"b",batch="true"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Error expected line %s in:\n%s", line, body)
+		}
+	}
+}
+
+func TestCallStats(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	var res []int
+	if err := p.Call(&res, "tests", "test_returns_setof_integer"); err != nil {
+		t.Fatalf("Error calling: %s", err)
+	}
+	var b bool
+	p.Call(&b, "tests", "function_raising_exception")
+	stats := p.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("Error in stats: %+v", stats)
+	}
+	if stats[0].Proc != "function_raising_exception" || stats[0].Errors["P0001"] != 1 {
+		t.Errorf("Error in stats of failed call: %+v", stats[0])
+	}
+	if stats[1].Calls != 1 || stats[1].Rows != 3 {
+		t.Errorf("Error in stats of setof call: %+v", stats[1])
+	}
+}
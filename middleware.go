@@ -0,0 +1,87 @@
+package pgproc
+
+import (
+	"context"
+)
+
+// Invocation is a call of a procedure, as seen by the middlewares
+type Invocation struct {
+	// Schema and Proc name the procedure. They are read-only: the return
+	// type is resolved before the middlewares are called
+	Schema string
+	Proc   string
+	// Params are the parameters of the call, which the middlewares
+	// can modify before calling the next Invoker, without changing
+	// their number
+	Params []interface{}
+	// Result is the destination of the result given to Call,
+	// nil if the result is ignored
+	Result interface{}
+	// ReturnType describes the result of the procedure
+	ReturnType ReturnType
+	// Rows is the number of rows returned, set once the procedure is called
+	Rows int
+
+	rt *returnType
+}
+
+// ReturnType describes the result of a procedure, as found in the catalog
+type ReturnType struct {
+	// Setof is true if the procedure returns a set of rows
+	Setof bool
+	// Type is the name of the type of a scalar result in pg_type,
+	// empty for a composite result
+	Type string
+	// Fields are the attributes of a composite result
+	Fields []Field
+	// ArgTypes are the names of the types of the arguments in pg_type
+	ArgTypes []string
+	// Volatility is immutable, stable or volatile
+	Volatility string
+}
+
+// export returns the exported description of rt
+func (rt *returnType) export() ReturnType {
+	e := ReturnType{Setof: rt.setof, ArgTypes: rt.argTypes, Volatility: volatilities[rt.volatility]}
+	if rt.scalar {
+		e.Type = rt.scalarType
+	}
+	for i, name := range rt.compositeNames {
+		e.Fields = append(e.Fields, Field{Name: name, Type: rt.compositeTypes[i]})
+	}
+	return e
+}
+
+// Invoker calls a procedure
+type Invoker func(ctx context.Context, inv *Invocation) error
+
+// Middleware returns an Invoker wrapping next, which can act before and
+// after the call, modify the invocation, return without calling next,
+// or wrap its error
+type Middleware func(next Invoker) Invoker
+
+// Use adds middlewares around the calls, after the call policy is checked
+// and the return type is resolved. The first middleware added is the
+// outermost one.
+// Use must be called before the PgProc is used.
+//
+//	base.Use(func(next pgproc.Invoker) pgproc.Invoker {
+//		return func(ctx context.Context, inv *pgproc.Invocation) error {
+//			start := time.Now()
+//			err := next(ctx, inv)
+//			log.Printf("%s.%s: %s %v", inv.Schema, inv.Proc, time.Since(start), err)
+//			return err
+//		}
+//	})
+func (p *PgProc) Use(middlewares ...Middleware) {
+	p.middlewares = append(p.middlewares, middlewares...)
+}
+
+// invoker returns the Invoker calling the procedure through the middlewares
+func (p *PgProc) invoker() Invoker {
+	invoke := Invoker(p.invoke)
+	for i := len(p.middlewares) - 1; i >= 0; i-- {
+		invoke = p.middlewares[i](invoke)
+	}
+	return invoke
+}
@@ -0,0 +1,76 @@
+package pgproc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewaresOrder(t *testing.T) {
+	var (
+		p     PgProc
+		trace []string
+	)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		p.Use(func(next Invoker) Invoker {
+			return func(ctx context.Context, inv *Invocation) error {
+				trace = append(trace, name+">")
+				err := next(ctx, inv)
+				trace = append(trace, "<"+name)
+				return err
+			}
+		})
+	}
+	errShort := errors.New("short-circuited")
+	p.Use(func(next Invoker) Invoker {
+		return func(ctx context.Context, inv *Invocation) error {
+			return errShort
+		}
+	})
+	err := p.invoker()(context.Background(), &Invocation{})
+	if err != errShort || strings.Join(trace, "") != "a>b><b<a" {
+		t.Errorf("Error in middlewares order: %s %v", strings.Join(trace, ""), err)
+	}
+}
+
+func TestReturnTypeExport(t *testing.T) {
+	rt := &returnType{setof: true, compositeNames: []string{"a", "b"}, compositeTypes: []string{"int4", "varchar"}, argTypes: []string{"int4"}}
+	expected := ReturnType{Setof: true, Fields: []Field{{"a", "int4"}, {"b", "varchar"}}, ArgTypes: []string{"int4"}}
+	if e := rt.export(); !reflect.DeepEqual(e, expected) {
+		t.Errorf("Error exporting return type: %+v", e)
+	}
+}
+
+func TestUse(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	var seen ReturnType
+	p.Use(func(next Invoker) Invoker {
+		return func(ctx context.Context, inv *Invocation) error {
+			seen = inv.ReturnType
+			inv.Params[0] = 99
+			if err := next(ctx, inv); err != nil {
+				return fmt.Errorf("%s.%s: %w", inv.Schema, inv.Proc, err)
+			}
+			return nil
+		}
+	})
+	var res int
+	if err := p.Call(&res, "tests", "test_returns_incremented_integer", 1); err != nil || res != 100 {
+		t.Errorf("Error expected modified parameter: %d %v", res, err)
+	}
+	if seen.Type != "int4" || seen.Setof || len(seen.ArgTypes) != 1 {
+		t.Errorf("Error in return type: %+v", seen)
+	}
+	var b bool
+	err = p.Call(&b, "tests", "function_raising_exception")
+	if err == nil || !strings.HasPrefix(err.Error(), "tests.function_raising_exception: ") {
+		t.Errorf("Error expected wrapped error: %v", err)
+	}
+}
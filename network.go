@@ -0,0 +1,228 @@
+package pgproc
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+)
+
+// UUID is a PostgreSQL uuid value
+type UUID [16]byte
+
+// ParseUUID parses the textual form of an UUID, with or without hyphens and braces
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	h := strings.Replace(strings.Trim(s, "{}"), "-", "", -1)
+	if len(h) != 2*len(u) {
+		return u, fmt.Errorf("invalid UUID '%s'", s)
+	}
+	if _, err := hex.Decode(u[:], []byte(h)); err != nil {
+		return u, fmt.Errorf("invalid UUID '%s'", s)
+	}
+	return u, nil
+}
+
+// String returns the canonical textual form of u
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// Scan implements the sql.Scanner interface
+func (u *UUID) Scan(src interface{}) error {
+	return decodeUUID(reflect.ValueOf(u).Elem(), src)
+}
+
+// Value implements the driver.Valuer interface
+func (u UUID) Value() (driver.Value, error) {
+	return u.String(), nil
+}
+
+var (
+	ipType           = reflect.TypeOf(net.IP(nil))
+	ipNetType        = reflect.TypeOf(net.IPNet{})
+	hardwareAddrType = reflect.TypeOf(net.HardwareAddr(nil))
+	addrType         = reflect.TypeOf(netip.Addr{})
+	prefixType       = reflect.TypeOf(netip.Prefix{})
+)
+
+// networkDecoder returns a decodeFunc storing a value of the PostgreSQL
+// type typname into an UUID-like, IP address, network or MAC address Go type,
+// or nil for other types
+func networkDecoder(t reflect.Type, typname string) decodeFunc {
+	switch {
+	case typname == "uuid" && t.Kind() == reflect.Array &&
+		t.Len() == 16 && t.Elem().Kind() == reflect.Uint8:
+		return decodeUUID
+	case t == ipType && (typname == "inet" || typname == "cidr"):
+		return decodeIP
+	case t == hardwareAddrType && (typname == "macaddr" || typname == "macaddr8"):
+		return decodeHardwareAddr
+	case t == ipNetType:
+		return decodeIPNet
+	case t == addrType:
+		return decodeAddr
+	case t == prefixType:
+		return decodePrefix
+	}
+	return nil
+}
+
+func decodeUUID(dest reflect.Value, src interface{}) error {
+	if src == nil {
+		return setNull(dest)
+	}
+	text, err := textOf(src)
+	if err != nil {
+		return err
+	}
+	u, err := ParseUUID(text)
+	if err != nil {
+		return err
+	}
+	reflect.Copy(dest, reflect.ValueOf(u[:]))
+	return nil
+}
+
+func decodeIP(dest reflect.Value, src interface{}) error {
+	if src == nil {
+		return setNull(dest)
+	}
+	addr, err := decodeAddrText(src)
+	if err != nil {
+		return err
+	}
+	dest.Set(reflect.ValueOf(net.IP(addr.AsSlice())))
+	return nil
+}
+
+func decodeIPNet(dest reflect.Value, src interface{}) error {
+	if src == nil {
+		return setNull(dest)
+	}
+	prefix, err := decodePrefixText(src)
+	if err != nil {
+		return err
+	}
+	bits := prefix.Addr().BitLen()
+	dest.Set(reflect.ValueOf(net.IPNet{
+		IP:   net.IP(prefix.Addr().AsSlice()),
+		Mask: net.CIDRMask(prefix.Bits(), bits),
+	}))
+	return nil
+}
+
+func decodeAddr(dest reflect.Value, src interface{}) error {
+	if src == nil {
+		return setNull(dest)
+	}
+	addr, err := decodeAddrText(src)
+	if err != nil {
+		return err
+	}
+	dest.Set(reflect.ValueOf(addr))
+	return nil
+}
+
+func decodePrefix(dest reflect.Value, src interface{}) error {
+	if src == nil {
+		return setNull(dest)
+	}
+	prefix, err := decodePrefixText(src)
+	if err != nil {
+		return err
+	}
+	dest.Set(reflect.ValueOf(prefix))
+	return nil
+}
+
+func decodeHardwareAddr(dest reflect.Value, src interface{}) error {
+	if src == nil {
+		return setNull(dest)
+	}
+	text, err := textOf(src)
+	if err != nil {
+		return err
+	}
+	mac, err := net.ParseMAC(text)
+	if err != nil {
+		return err
+	}
+	dest.Set(reflect.ValueOf(mac))
+	return nil
+}
+
+// decodeAddrText parses an inet or cidr value, ignoring the netmask
+func decodeAddrText(src interface{}) (netip.Addr, error) {
+	text, err := textOf(src)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if i := strings.IndexByte(text, '/'); i >= 0 {
+		text = text[:i]
+	}
+	return netip.ParseAddr(text)
+}
+
+// decodePrefixText parses an inet or cidr value; an inet value written
+// without netmask is a single host
+func decodePrefixText(src interface{}) (netip.Prefix, error) {
+	text, err := textOf(src)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if strings.IndexByte(text, '/') < 0 {
+		addr, err := netip.ParseAddr(text)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	// keep the host bits of inet values
+	return netip.ParsePrefix(text)
+}
+
+// encodeNetwork returns the textual form of param if it is an UUID-like,
+// IP address, network or MAC address value; ok is false for other types
+func encodeNetwork(param interface{}) (value interface{}, ok bool) {
+	switch n := param.(type) {
+	case net.IP:
+		if n == nil {
+			return nil, true
+		}
+		return n.String(), true
+	case *net.IPNet:
+		if n == nil {
+			return nil, true
+		}
+		return n.String(), true
+	case net.IPNet:
+		return n.String(), true
+	case net.HardwareAddr:
+		if n == nil {
+			return nil, true
+		}
+		return n.String(), true
+	case netip.Addr:
+		if !n.IsValid() {
+			return nil, true
+		}
+		return n.String(), true
+	case netip.Prefix:
+		if !n.IsValid() {
+			return nil, true
+		}
+		return n.String(), true
+	}
+	v := reflect.ValueOf(param)
+	if v.Kind() == reflect.Array && v.Len() == 16 && v.Type().Elem().Kind() == reflect.Uint8 {
+		var u UUID
+		reflect.Copy(reflect.ValueOf(u[:]), v)
+		return u.String(), true
+	}
+	return nil, false
+}
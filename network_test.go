@@ -0,0 +1,132 @@
+package pgproc
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+type DeviceId [16]byte
+
+type Device struct {
+	DevId      DeviceId         `pgproc:"dev_id"`
+	DevAddress netip.Prefix     `pgproc:"dev_address"`
+	DevNetwork *net.IPNet       `pgproc:"dev_network"`
+	DevMac     net.HardwareAddr `pgproc:"dev_mac"`
+}
+
+const aUUID = "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"
+
+func TestParseUUID(t *testing.T) {
+	u, err := ParseUUID("{A0EEBC999C0B4EF8BB6D6BB9BD380A11}")
+	if err != nil {
+		t.Errorf("Error parsing UUID")
+	}
+	if u.String() != aUUID {
+		t.Errorf("Error expected %s value is %s", aUUID, u)
+	}
+	if _, err := ParseUUID("a0eebc99"); err == nil {
+		t.Errorf("Error expected an error for an invalid UUID")
+	}
+}
+
+func TestCallReturnsUUID(t *testing.T) {
+	var res UUID
+	err := base.Call(&res, "tests", "test_returns_uuid")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_uuid")
+	}
+	if res.String() != aUUID {
+		t.Errorf("Error expected %s value is %s", aUUID, res)
+	}
+}
+
+func TestReturnsSameUUID(t *testing.T) {
+	var res DeviceId
+	input, _ := ParseUUID(aUUID)
+	err := base.Call(&res, "tests", "test_returns_same_uuid", DeviceId(input))
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_uuid")
+	}
+	if UUID(res) != input {
+		t.Errorf("Error expected %s value is %s", input, UUID(res))
+	}
+}
+
+func TestCallReturnsUUIDArray(t *testing.T) {
+	var res []UUID
+	err := base.Call(&res, "tests", "test_returns_uuid_array")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_uuid_array")
+	}
+	if len(res) != 2 || res[0].String() != aUUID || res[1] != (UUID{15: 1}) {
+		t.Errorf("Error expected values are %v", res)
+	}
+}
+
+func TestReturnsSameInet(t *testing.T) {
+	var ip net.IP
+	err := base.Call(&ip, "tests", "test_returns_same_inet", net.ParseIP("192.168.0.1"))
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_inet")
+	}
+	if !ip.Equal(net.ParseIP("192.168.0.1")) {
+		t.Errorf("Error expected 192.168.0.1 value is %s", ip)
+	}
+
+	var addr netip.Addr
+	input := netip.MustParseAddr("2001:db8::1")
+	err = base.Call(&addr, "tests", "test_returns_same_inet", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_inet")
+	}
+	if addr != input {
+		t.Errorf("Error expected %s value is %s", input, addr)
+	}
+
+	var prefix netip.Prefix
+	inputPrefix := netip.MustParsePrefix("10.1.2.3/16")
+	err = base.Call(&prefix, "tests", "test_returns_same_inet", inputPrefix)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_inet")
+	}
+	if prefix != inputPrefix {
+		t.Errorf("Error expected %s value is %s", inputPrefix, prefix)
+	}
+}
+
+func TestCallReturnsSetofInet(t *testing.T) {
+	ch := make(chan netip.Addr)
+	go base.Call(ch, "tests", "test_returns_setof_inet")
+	a := <-ch
+	b := <-ch
+	if a != netip.MustParseAddr("192.168.0.1") || b != netip.MustParseAddr("2001:db8::1") {
+		t.Errorf("Error expected values")
+	}
+}
+
+func TestInetArrayArg(t *testing.T) {
+	var res []net.IP
+	input := []netip.Addr{netip.MustParseAddr("192.168.0.1"), netip.MustParseAddr("::1")}
+	err := base.Call(&res, "tests", "test_returns_inet_array", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_inet_array")
+	}
+	if len(res) != 2 || !res[0].Equal(net.ParseIP("192.168.0.1")) || !res[1].Equal(net.IPv6loopback) {
+		t.Errorf("Error expected values are %v", res)
+	}
+}
+
+func TestReturnsCompositeWithNetwork(t *testing.T) {
+	var res Device
+	err := base.Call(&res, "tests", "test_returns_device")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_device")
+	}
+	if UUID(res.DevId).String() != aUUID ||
+		res.DevAddress != netip.MustParsePrefix("10.0.0.5/8") ||
+		res.DevNetwork == nil || res.DevNetwork.String() != "10.0.0.0/8" ||
+		res.DevMac.String() != "08:00:2b:01:02:03" {
+		t.Errorf("Error expected value is %v", res)
+	}
+}
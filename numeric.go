@@ -0,0 +1,224 @@
+package pgproc
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// Decimal is a PostgreSQL numeric value kept in its exact textual form,
+// including the special values NaN, Infinity and -Infinity.
+// The empty Decimal is NULL.
+type Decimal string
+
+const (
+	DecimalNaN           Decimal = "NaN"
+	DecimalInfinity      Decimal = "Infinity"
+	DecimalMinusInfinity Decimal = "-Infinity"
+)
+
+var (
+	ErrNumericNaN        = errors.New("numeric value is NaN")
+	ErrNumericInfinity   = errors.New("numeric value is infinite")
+	ErrNumericNotInteger = errors.New("numeric value is not an integer")
+	ErrNumericInexact    = errors.New("rational value has no exact decimal representation")
+)
+
+var (
+	ratType    = reflect.TypeOf(big.Rat{})
+	ratPtrType = reflect.TypeOf((*big.Rat)(nil))
+	intType    = reflect.TypeOf(big.Int{})
+	intPtrType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// NewDecimalFromRat returns the exact decimal form of r, or ErrNumericInexact
+// if r cannot be written with a finite number of decimal digits (1/3 for example)
+func NewDecimalFromRat(r *big.Rat) (Decimal, error) {
+	if r == nil {
+		return "", nil
+	}
+	scale, ok := decimalScale(r.Denom())
+	if !ok {
+		return "", ErrNumericInexact
+	}
+	return Decimal(r.FloatString(scale)), nil
+}
+
+// NewDecimalFromInt returns the decimal form of i
+func NewDecimalFromInt(i *big.Int) Decimal {
+	if i == nil {
+		return ""
+	}
+	return Decimal(i.String())
+}
+
+// Scan implements the sql.Scanner interface
+func (d *Decimal) Scan(src interface{}) error {
+	if src == nil {
+		*d = ""
+		return nil
+	}
+	text, err := textOf(src)
+	if err != nil {
+		return err
+	}
+	*d = Decimal(text)
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (d Decimal) Value() (driver.Value, error) {
+	if d.IsNull() {
+		return nil, nil
+	}
+	return string(d), nil
+}
+
+// IsNull returns true if d is NULL
+func (d Decimal) IsNull() bool {
+	return d == ""
+}
+
+// IsNaN returns true if d is NaN
+func (d Decimal) IsNaN() bool {
+	return strings.EqualFold(string(d), string(DecimalNaN))
+}
+
+// IsInf returns true if d is an infinity with the given sign:
+// Infinity if sign > 0, -Infinity if sign < 0, any of them if sign == 0
+func (d Decimal) IsInf(sign int) bool {
+	switch {
+	case strings.EqualFold(string(d), string(DecimalInfinity)),
+		strings.EqualFold(string(d), "+Infinity"):
+		return sign >= 0
+	case strings.EqualFold(string(d), string(DecimalMinusInfinity)):
+		return sign <= 0
+	}
+	return false
+}
+
+// Rat returns the exact value of d
+func (d Decimal) Rat() (*big.Rat, error) {
+	switch {
+	case d.IsNull():
+		return nil, nil
+	case d.IsNaN():
+		return nil, ErrNumericNaN
+	case d.IsInf(0):
+		return nil, ErrNumericInfinity
+	}
+	r, ok := new(big.Rat).SetString(string(d))
+	if !ok {
+		return nil, fmt.Errorf("invalid numeric value '%s'", string(d))
+	}
+	return r, nil
+}
+
+// Int returns the value of d, or ErrNumericNotInteger if d has a fractional part
+func (d Decimal) Int() (*big.Int, error) {
+	r, err := d.Rat()
+	if r == nil || err != nil {
+		return nil, err
+	}
+	if !r.IsInt() {
+		return nil, ErrNumericNotInteger
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// decimalScale returns the number of decimal digits needed to write
+// exactly a fraction with the denominator denom
+func decimalScale(denom *big.Int) (int, bool) {
+	d := new(big.Int).Set(denom)
+	var twos, fives int
+	two, five := big.NewInt(2), big.NewInt(5)
+	m := new(big.Int)
+	for d.Sign() > 0 {
+		if q, r := new(big.Int).QuoRem(d, two, m); r.Sign() == 0 {
+			d, twos = q, twos+1
+			continue
+		}
+		if q, r := new(big.Int).QuoRem(d, five, m); r.Sign() == 0 {
+			d, fives = q, fives+1
+			continue
+		}
+		break
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
+
+// numericDecoder returns a decodeFunc storing a numeric value into
+// a big.Rat or a big.Int (or pointers to them), or nil for other types
+func numericDecoder(t reflect.Type) decodeFunc {
+	switch t {
+	case ratType, ratPtrType, intType, intPtrType:
+		return decodeNumeric
+	}
+	return nil
+}
+
+func decodeNumeric(dest reflect.Value, src interface{}) error {
+	if src == nil {
+		return setNull(dest)
+	}
+	text, err := textOf(src)
+	if err != nil {
+		return err
+	}
+	d := Decimal(text)
+	switch dest.Type() {
+	case ratType, ratPtrType:
+		r, err := d.Rat()
+		if err != nil {
+			return err
+		}
+		if dest.Kind() == reflect.Ptr {
+			dest.Set(reflect.ValueOf(r))
+		} else {
+			dest.Set(reflect.ValueOf(r).Elem())
+		}
+	case intType, intPtrType:
+		i, err := d.Int()
+		if err != nil {
+			return err
+		}
+		if dest.Kind() == reflect.Ptr {
+			dest.Set(reflect.ValueOf(i))
+		} else {
+			dest.Set(reflect.ValueOf(i).Elem())
+		}
+	}
+	return nil
+}
+
+// encodeNumeric returns the numeric text of param if it is a big.Rat or
+// a big.Int; ok is false for other types
+func encodeNumeric(param interface{}) (value interface{}, ok bool, err error) {
+	var d Decimal
+	switch n := param.(type) {
+	case *big.Rat:
+		d, err = NewDecimalFromRat(n)
+	case big.Rat:
+		d, err = NewDecimalFromRat(&n)
+	case *big.Int:
+		d = NewDecimalFromInt(n)
+	case big.Int:
+		d = NewDecimalFromInt(&n)
+	default:
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	value, err = d.Value()
+	return value, true, err
+}
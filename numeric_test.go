@@ -0,0 +1,167 @@
+package pgproc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+type Invoice struct {
+	InvId     int        `pgproc:"inv_id"`
+	InvAmount Decimal    `pgproc:"inv_amount"`
+	InvLines  []*big.Rat `pgproc:"inv_lines"`
+}
+
+func TestNewDecimalFromRat(t *testing.T) {
+	d, err := NewDecimalFromRat(big.NewRat(314159, 100000))
+	if err != nil || d != "3.14159" {
+		t.Errorf("Error expected '3.14159' value is '%s' (%v)", d, err)
+	}
+	d, err = NewDecimalFromRat(big.NewRat(1, 8))
+	if err != nil || d != "0.125" {
+		t.Errorf("Error expected '0.125' value is '%s' (%v)", d, err)
+	}
+	_, err = NewDecimalFromRat(big.NewRat(1, 3))
+	if err != ErrNumericInexact {
+		t.Errorf("Error expected ErrNumericInexact")
+	}
+}
+
+func TestDecimalSpecialValues(t *testing.T) {
+	if !Decimal("NaN").IsNaN() || Decimal("1").IsNaN() {
+		t.Errorf("Error IsNaN")
+	}
+	if !Decimal("Infinity").IsInf(1) || Decimal("Infinity").IsInf(-1) ||
+		!Decimal("-Infinity").IsInf(-1) || !Decimal("-Infinity").IsInf(0) {
+		t.Errorf("Error IsInf")
+	}
+	if _, err := DecimalNaN.Rat(); err != ErrNumericNaN {
+		t.Errorf("Error expected ErrNumericNaN")
+	}
+	if _, err := DecimalInfinity.Int(); err != ErrNumericInfinity {
+		t.Errorf("Error expected ErrNumericInfinity")
+	}
+	if _, err := Decimal("1.5").Int(); err != ErrNumericNotInteger {
+		t.Errorf("Error expected ErrNumericNotInteger")
+	}
+}
+
+func TestCallReturnsNumericAsRat(t *testing.T) {
+	var res *big.Rat
+	err := base.Call(&res, "tests", "test_returns_numeric")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_numeric")
+	}
+	if res == nil || res.Cmp(big.NewRat(314159, 100000)) != 0 {
+		t.Errorf("Error expected 3.14159 value is %v", res)
+	}
+}
+
+func TestCallReturnsNumericAsDecimal(t *testing.T) {
+	var res Decimal
+	err := base.Call(&res, "tests", "test_returns_big_numeric")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_big_numeric")
+	}
+	expected := Decimal("12345678901234567890.123456789012345678")
+	if res != expected {
+		t.Errorf("Error expected %s value is %s", expected, res)
+	}
+}
+
+func TestCallReturnsNumericAsInt(t *testing.T) {
+	var res big.Int
+	err := base.Call(&res, "tests", "test_returns_incremented_numeric", 40.5)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_incremented_numeric")
+	}
+	if res.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("Error expected 42 value is %s", res.String())
+	}
+
+	err = base.Call(&res, "tests", "test_returns_numeric")
+	if !errors.Is(err, ErrNumericNotInteger) {
+		t.Errorf("Error expected ErrNumericNotInteger")
+	}
+}
+
+func TestCallReturnsNumericNaN(t *testing.T) {
+	var res Decimal
+	err := base.Call(&res, "tests", "test_returns_numeric_nan")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_numeric_nan")
+	}
+	if !res.IsNaN() {
+		t.Errorf("Error expected NaN value is %s", res)
+	}
+
+	var rat *big.Rat
+	err = base.Call(&rat, "tests", "test_returns_numeric_nan")
+	if !errors.Is(err, ErrNumericNaN) {
+		t.Errorf("Error expected ErrNumericNaN")
+	}
+}
+
+func TestCallReturnsSetofNumericAsRat(t *testing.T) {
+	ch := make(chan *big.Rat)
+	go base.Call(ch, "tests", "test_returns_setof_numeric")
+	a := <-ch
+	b := <-ch
+	if a.Cmp(big.NewRat(314159, 100000)) != 0 || b.Cmp(big.NewRat(449, 100)) != 0 {
+		t.Errorf("Error expected values")
+	}
+}
+
+func TestCallReturnsNumericArray(t *testing.T) {
+	var res []*big.Rat
+	err := base.Call(&res, "tests", "test_returns_numeric_array")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_numeric_array")
+	}
+	if len(res) != 3 || res[0].Cmp(big.NewRat(3, 2)) != 0 || res[1] != nil ||
+		res[2].Cmp(big.NewRat(9, 4)) != 0 {
+		t.Errorf("Error expected values are %v", res)
+	}
+}
+
+func TestNumericArrayArg(t *testing.T) {
+	var res []Decimal
+	input := []*big.Rat{big.NewRat(1, 10), nil, big.NewRat(-7, 4)}
+	err := base.Call(&res, "tests", "test_returns_same_numeric_array", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_numeric_array: %s", err)
+	}
+	if len(res) != 3 || res[0] != "0.1" || !res[1].IsNull() || res[2] != "-1.75" {
+		t.Errorf("Error expected values are %v", res)
+	}
+}
+
+func TestReturnsIncrementedRat(t *testing.T) {
+	var res *big.Rat
+	input := big.NewRat(1, 10)
+	err := base.Call(&res, "tests", "test_returns_incremented_numeric", input)
+	if err != nil {
+		t.Errorf("Error calling test_returns_incremented_numeric")
+	}
+	if res == nil || res.Cmp(big.NewRat(16, 10)) != 0 {
+		t.Errorf("Error expected 1.6 value is %v", res)
+	}
+
+	err = base.Call(&res, "tests", "test_returns_incremented_numeric", big.NewRat(1, 3))
+	if err == nil {
+		t.Errorf("Error expected an error for an inexact parameter")
+	}
+}
+
+func TestReturnsCompositeWithNumeric(t *testing.T) {
+	var res Invoice
+	err := base.Call(&res, "tests", "test_returns_invoice")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_invoice")
+	}
+	if res.InvId != 1 || res.InvAmount != "10.10" || len(res.InvLines) != 2 ||
+		res.InvLines[0].Cmp(big.NewRat(405, 100)) != 0 ||
+		res.InvLines[1].Cmp(big.NewRat(605, 100)) != 0 {
+		t.Errorf("Error expected value is %v", res)
+	}
+}
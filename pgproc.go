@@ -1,6 +1,7 @@
 package pgproc
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -12,7 +13,21 @@ import (
 )
 
 type PgProc struct {
-	db *sql.DB
+	db              *sql.DB
+	conninfo        string
+	infinity        infinity
+	location        *time.Location
+	codecs          map[string]Codec
+	calls           []registeredCall
+	policy          CallPolicy
+	middlewares     []Middleware
+	metrics         metrics
+	tracer          Tracer
+	comment         map[string]string
+	applicationName string
+	retryPolicy     *RetryPolicy
+	replicas        *replicas
+	cache           *resultCache
 }
 
 type returnType struct {
@@ -21,22 +36,33 @@ type returnType struct {
 	scalarType     string
 	compositeNames pq.StringArray
 	compositeTypes pq.StringArray
+	argTypes       pq.StringArray
+	volatility     string
+	// annotated tells if the comment of the function has the @cache
+	// annotation, with the time to live cacheTTL
+	annotated bool
+	cacheTTL  time.Duration
 }
 
+// Default values of infinite dates and timestamps, see SetInfinity
 var (
 	DateMinusInfinity = time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
 	DateInfinity      = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
 )
 
+// defaultPgProc is the PgProc with the default settings used by the
+// package-level functions
+var defaultPgProc = &PgProc{infinity: infinity{negative: DateMinusInfinity, positive: DateInfinity}}
+
 // NewPgProc creates a new connection to a PostgreSQL database
 func NewPgProc(conninfo string) (*PgProc, error) {
-	var pgproc = PgProc{}
+	var pgproc = PgProc{conninfo: conninfo}
 	var err error
 	pgproc.db, err = sql.Open("postgres", conninfo)
 	if err != nil {
 		return nil, err
 	}
-	pq.EnableInfinityTs(DateMinusInfinity, DateInfinity)
+	pgproc.infinity = infinity{negative: DateMinusInfinity, positive: DateInfinity}
 	return &pgproc, nil
 }
 
@@ -46,114 +72,272 @@ func (p *PgProc) SetConcurrency(n int) {
 
 // Call calls a PostgreSQL procedure and stores the result
 func (p *PgProc) Call(result interface{}, schema string, proc string, params ...interface{}) error {
+	return p.CallContext(context.Background(), result, schema, proc, params...)
+}
+
+// CallContext calls a PostgreSQL procedure and stores the result.
+// The result of a SETOF procedure is sent to a channel, which is closed
+// when CallContext returns, even on error, or appended to the slice
+// pointed to by result. The sending to the channel stops when ctx is done.
+func (p *PgProc) CallContext(ctx context.Context, result interface{}, schema string, proc string, params ...interface{}) (err error) {
+	if v := reflect.ValueOf(result); v.Kind() == reflect.Chan {
+		defer v.Close()
+	}
+
+	if err := p.checkPolicy(ctx, schema, proc, len(params)); err != nil {
+		return err
+	}
 
-	if proc[0] == '_' {
-		return errors.New("function not callable")
+	inv := &Invocation{Schema: schema, Proc: proc, Params: params, Result: result}
+	ctx, span := p.startSpan(ctx, schema+"."+proc,
+		Attribute{Key: "db.system", Value: "postgresql"},
+		Attribute{Key: "pgproc.arity", Value: len(params)})
+	start := time.Now()
+	defer func() {
+		p.metrics.record(inv, false, time.Since(start), err)
+		span.SetAttributes(Attribute{Key: "pgproc.rows", Value: inv.Rows})
+		endSpan(span, err)
+	}()
+
+	lookupCtx, lookup := p.startSpan(ctx, "catalog lookup")
+	rt, err := p.lookupReturnType(lookupCtx, schema, proc, len(params))
+	endSpan(lookup, err)
+	if err != nil {
+		return err
 	}
+	inv.ReturnType, inv.rt = rt.export(), rt
+	return p.invoker()(ctx, inv)
+}
 
-	rt, err := p.getReturnType(schema, proc, len(params))
+// invoke is the Invoker calling the procedure, at the end of the middlewares
+func (p *PgProc) invoke(ctx context.Context, inv *Invocation) (err error) {
+	ctx, span := p.startSpan(ctx, "execute")
+	defer func() {
+		endSpan(span, err)
+	}()
+	params, err := p.encodeParams(inv.Params, inv.rt.argTypes)
 	if err != nil {
 		return err
 	}
-	query := fmt.Sprintf("SELECT * FROM %s.%s(%s)",
-		pq.QuoteIdentifier(schema),
-		pq.QuoteIdentifier(proc),
+	cached := p.cachedCall(ctx, inv, params)
+	if cached != nil && p.cache.load(cached, inv) {
+		span.SetAttributes(Attribute{Key: "pgproc.cache", Value: "hit"})
+		return nil
+	}
+	query := fmt.Sprintf("%sSELECT * FROM %s.%s(%s)",
+		p.queryComment(ctx, span),
+		pq.QuoteIdentifier(inv.Schema),
+		pq.QuoteIdentifier(inv.Proc),
 		paramsString(len(params)))
 
+	var (
+		attempts       int
+		checked, retry bool
+	)
+	safe := func() bool {
+		if inv.Rows > 0 {
+			// rows have already been stored into the result
+			return false
+		}
+		if !checked {
+			retry, checked = p.safeToRetry(ctx, inv.Schema, inv.Proc, len(inv.Params)), true
+		}
+		return retry
+	}
+	defer func() {
+		span.SetAttributes(Attribute{Key: "pgproc.attempts", Value: attempts})
+	}()
+	err = p.withRetries(ctx, safe, func() error {
+		attempts++
+		q, end, err := p.begin(ctx, inv.rt.volatility != "v")
+		if err != nil {
+			return err
+		}
+		return end(p.call(ctx, q, inv, query, params))
+	})
+	if err == nil && cached != nil {
+		p.cache.store(cached, inv)
+	}
+	return err
+}
+
+// call runs the query of a call with q, stores the result
+// and counts the rows returned
+func (p *PgProc) call(ctx context.Context, q querier, inv *Invocation, query string, params []interface{}) error {
+	if inv.Result == nil {
+		_, err := q.ExecContext(ctx, query, params...)
+		return err
+	}
+	rows, err := q.QueryContext(ctx, query, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return p.scanResult(ctx, rows, inv)
+}
+
+// scanResult stores the rows of the current result set of rows into
+// the result of inv, and counts them; the rows are not read further after
+// an error
+func (p *PgProc) scanResult(ctx context.Context, rows *sql.Rows, inv *Invocation) error {
+	var (
+		rt     = inv.rt
+		result = inv.Result
+	)
+	if result == nil {
+		for rows.Next() {
+		}
+		return rows.Err()
+	}
+
+	if rt.setof {
+		elemType, add := setofResult(ctx, result)
+		for rows.Next() {
+			// val is a new element of the same type of the channel or slice type
+			val := reflect.New(elemType).Elem()
+			if err := p.scanElem(rows, rt, val); err != nil {
+				return err
+			}
+			if err := add(val); err != nil {
+				return err
+			}
+			inv.Rows++
+		}
+		return rows.Err()
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	var err error
 	if rt.scalar {
-		if !rt.setof {
-			if result != nil {
-				row := p.db.QueryRow(query, params...)
-				if rt.scalarType == "json" {
-					switch result.(type) {
-					case *string: // return json if a string is passes as arg
-						err = row.Scan(result)
-					default:
-						var temp string
-						err = row.Scan(&temp)
-						if err == nil {
-							err = json.Unmarshal([]byte(temp), result)
-						}
-					}
-				} else {
-					err = row.Scan(result)
+		if rt.scalarType == "json" {
+			switch result.(type) {
+			case *string: // return json if a string is passes as arg
+				err = rows.Scan(result)
+			default:
+				var temp string
+				err = rows.Scan(&temp)
+				if err == nil {
+					err = json.Unmarshal([]byte(temp), result)
 				}
-				
-			} else {
-				_, err = p.db.Exec(query, params...)
 			}
 		} else {
-			rows, _ := p.db.Query(query, params...)
-			defer rows.Close()
-			c := reflect.ValueOf(result) // the channel we have to send to
-			// val is a zero element of the same type of the channel type
-			val := reflect.Zero(reflect.TypeOf(result).Elem()).Interface()
-			for rows.Next() {
-				if err := rows.Scan(&val); err != nil {
-					return err
-				}
-				c.Send(reflect.ValueOf(val))
-			}
-			c.Close()
+			err = rows.Scan(p.scanner(result, rt.scalarType))
 		}
 	} else {
-		if !rt.setof {
-			row := p.db.QueryRow(query, params...)
-			err = ScanCompositeRow(row, rt, result)
-		} else {
-			rows, _ := p.db.Query(query, params...)
-			defer rows.Close()
-			for rows.Next() {
-				if err := ScanCompositeRows(rows, rt, result); err != nil {
-					return err
-				}
-			}
-			c := reflect.ValueOf(result) // the channel we have to send to
-			c.Close()
+		var vs []interface{}
+		if vs, err = p.compositeFields(reflect.ValueOf(result).Elem(), rt); err == nil {
+			err = rows.Scan(vs...)
 		}
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	inv.Rows = 1
+	return nil
 }
 
+// ScanCompositeRow scans a row of a composite type into the struct pointed
+// to by result, with the default settings of a PgProc
 func ScanCompositeRow(row *sql.Row, rt *returnType, result interface{}) error {
-	v := reflect.ValueOf(result).Elem()
+	return defaultPgProc.ScanCompositeRow(row, rt, result)
+}
+
+// ScanCompositeRows scans the current row of a composite type as the method
+// of the same name, with the default settings of a PgProc
+func ScanCompositeRows(rows *sql.Rows, rt *returnType, result interface{}) error {
+	return defaultPgProc.ScanCompositeRows(rows, rt, result)
+}
+
+// ScanCompositeRow scans a row of a composite type into the struct pointed to by result
+func (p *PgProc) ScanCompositeRow(row *sql.Row, rt *returnType, result interface{}) error {
+	vs, err := p.compositeFields(reflect.ValueOf(result).Elem(), rt)
+	if err != nil {
+		return err
+	}
+	err = row.Scan(vs...)
+	return err
+}
+
+// ScanCompositeRows scans the current row of a composite type and sends it
+// to the channel result, or appends it to the slice pointed to by result
+func (p *PgProc) ScanCompositeRows(rows *sql.Rows, rt *returnType, result interface{}) error {
+	elemType, add := setofResult(context.Background(), result)
+	v := reflect.New(elemType).Elem()
+	if err := p.scanElem(rows, rt, v); err != nil {
+		return err
+	}
+	return add(v)
+}
+
+// scanElem scans the current row of a SETOF result into v
+func (p *PgProc) scanElem(rows *sql.Rows, rt *returnType, v reflect.Value) error {
+	if rt.scalar {
+		return rows.Scan(p.scanner(v.Addr().Interface(), rt.scalarType))
+	}
+	vs, err := p.compositeFields(v, rt)
+	if err != nil {
+		return err
+	}
+	return rows.Scan(vs...)
+}
+
+// compositeFields returns the destinations to give to Scan in order to store
+// the attributes of a composite type into the fields of the struct v
+func (p *PgProc) compositeFields(v reflect.Value, rt *returnType) ([]interface{}, error) {
 	var vs []interface{}
-	for _, name := range rt.compositeNames {
+	for i, name := range rt.compositeNames {
 		f := v.FieldByName(strings.Title(name))
 		if !f.IsValid() {
-			fieldName, found := getFieldByTag(result, name)
+			fieldName, found := getFieldByTag(v.Addr().Interface(), name)
 			if !found {
-				return errors.New("Error field " + name + " not found")
+				return nil, errors.New("Error field " + name + " not found")
 			}
 			f = v.FieldByName(fieldName)
 		}
-		field := f.Addr().Interface()
+		field := p.scanner(f.Addr().Interface(), rt.compositeTypes[i])
 		vs = append(vs, field)
 	}
-
-	err := row.Scan(vs...)
-	return err
-}
-
-func ScanCompositeRows(rows *sql.Rows, rt *returnType, result interface{}) error {
-	c := reflect.ValueOf(result) // the channel we have to send to
-	v := reflect.New(reflect.TypeOf(result).Elem()).Elem()
-	var vs []interface{}
-
-	for _, name := range rt.compositeNames {
-		field := v.FieldByName(strings.Title(name)).Addr().Interface()
-		vs = append(vs, field)
-	}
-
-	err := rows.Scan(vs...)
-	c.Send(v)
-	return err
+	return vs, nil
 }
 
 //
 // Local static functions
 //
 
+// setofResult returns the type of the elements of result, a channel or
+// a pointer to a slice, and a function adding an element to result,
+// returning the error of ctx if it is done before the element is sent
+func setofResult(ctx context.Context, result interface{}) (reflect.Type, func(reflect.Value) error) {
+	v := reflect.ValueOf(result)
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+		slice := v.Elem()
+		return slice.Type().Elem(), func(elem reflect.Value) error {
+			slice.Set(reflect.Append(slice, elem))
+			return nil
+		}
+	}
+	return v.Type().Elem(), func(elem reflect.Value) error {
+		chosen, _, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: v, Send: elem},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		})
+		if chosen == 1 {
+			return ctx.Err()
+		}
+		return nil
+	}
+}
+
 // paramsString returns a string $1,$2,...,$len
 func paramsString(len int) string {
 	if len == 0 {
@@ -167,10 +351,14 @@ func paramsString(len int) string {
 }
 
 // getReturnType gives the type returned by a postgreSQL procedure
-func (p *PgProc) getReturnType(schema string, proc string, nargs int) (*returnType, error) {
-	rt, err := p.getScalarReturnType(schema, proc, nargs)
+func (p *PgProc) getReturnType(ctx context.Context, schema string, proc string, nargs int) (*returnType, error) {
+	rt, err := p.getScalarReturnType(ctx, schema, proc, nargs)
 	if err == sql.ErrNoRows {
-		return p.getCompositeReturnType(schema, proc, nargs)
+		return p.getCompositeReturnType(ctx, schema, proc, nargs)
+	} else if err != nil {
+		return nil, err
+	} else if rt.scalarType == "record" {
+		return p.getRecordReturnType(ctx, schema, proc, nargs, rt)
 	} else {
 		return rt, nil
 	}
@@ -178,11 +366,16 @@ func (p *PgProc) getReturnType(schema string, proc string, nargs int) (*returnTy
 
 // getScalarReturnType gives the scalar type returned by a postgreSQL procedure
 // or returns a ErrNoRows error if the return type is not scalar
-func (p *PgProc) getScalarReturnType(schema string, proc string, nargs int) (*returnType, error) {
+func (p *PgProc) getScalarReturnType(ctx context.Context, schema string, proc string, nargs int) (*returnType, error) {
 	query := `
 SELECT
   pg_type_ret.typname, 
-  proretset
+  proretset,
+  (SELECT array_agg(typname ORDER BY ord) 
+   FROM unnest(proargtypes::oid[]) WITH ORDINALITY AS args(oid, ord)
+   INNER JOIN pg_type ON pg_type.oid = args.oid),
+  provolatile,
+  coalesce(obj_description(pg_proc.oid, 'pg_proc'), '')
 FROM pg_proc
 INNER JOIN pg_type pg_type_ret ON pg_type_ret.oid = pg_proc.prorettype
 INNER JOIN pg_namespace pg_namespace_ret ON pg_namespace_ret.oid = pg_type_ret.typnamespace
@@ -191,23 +384,28 @@ WHERE
   pg_namespace_proc.nspname = $1 AND 
   proname = $2 AND 
   pronargs = $3 AND 
-  typtype IN ('b', 'p', 'e')`
+  typtype IN ('b', 'p', 'e', 'd')`
 
-	row := p.db.QueryRow(query, schema, proc, nargs)
+	row := p.db.QueryRowContext(ctx, query, schema, proc, nargs)
 	var (
-		name  string
-		setof bool
+		name       string
+		setof      bool
+		argTypes   pq.StringArray
+		volatility string
+		comment    string
 	)
-	err := row.Scan(&name, &setof)
-	if err == sql.ErrNoRows {
+	err := row.Scan(&name, &setof, &argTypes, &volatility, &comment)
+	if err != nil {
 		return nil, err
 	} else {
-		return &returnType{scalar: true, setof: setof, scalarType: name}, nil
+		rt := &returnType{scalar: true, setof: setof, scalarType: name, argTypes: argTypes, volatility: volatility}
+		rt.cacheTTL, rt.annotated = cacheAnnotation(comment)
+		return rt, nil
 	}
 }
 
 // getCompositeReturnType gives the compiste type returned by a postgreSQL procedure
-func (p *PgProc) getCompositeReturnType(schema string, proc string, nargs int) (*returnType, error) {
+func (p *PgProc) getCompositeReturnType(ctx context.Context, schema string, proc string, nargs int) (*returnType, error) {
 	query := `
 SELECT 
   (SELECT array_agg(attname ORDER BY attnum) FROM pg_attribute 
@@ -215,7 +413,12 @@ SELECT
   (SELECT array_agg(typname ORDER BY attnum) FROM pg_attribute 
    INNER JOIN pg_type ON pg_attribute.atttypid = pg_type.oid 
    WHERE attrelid = pg_type_ret.typrelid AND attnum > 0),
-  proretset
+  proretset,
+  (SELECT array_agg(typname ORDER BY ord) 
+   FROM unnest(proargtypes::oid[]) WITH ORDINALITY AS args(oid, ord)
+   INNER JOIN pg_type ON pg_type.oid = args.oid),
+  provolatile,
+  coalesce(obj_description(pg_proc.oid, 'pg_proc'), '')
 FROM pg_proc
 INNER JOIN pg_type pg_type_ret ON pg_type_ret.oid = pg_proc.prorettype
 INNER JOIN pg_namespace pg_namespace_proc ON pg_namespace_proc.oid = pg_proc.pronamespace
@@ -225,21 +428,57 @@ WHERE
   pronargs = $3 AND
   pg_type_ret.typtype IN ('c')`
 
-	row := p.db.QueryRow(query, schema, proc, nargs)
+	row := p.db.QueryRowContext(ctx, query, schema, proc, nargs)
 	var (
-		names pq.StringArray
-		types pq.StringArray
-		setof bool
+		names      pq.StringArray
+		types      pq.StringArray
+		setof      bool
+		argTypes   pq.StringArray
+		volatility string
+		comment    string
 	)
-	err := row.Scan(&names, &types, &setof)
-	if err == sql.ErrNoRows {
-		return nil, sql.ErrNoRows
+	err := row.Scan(&names, &types, &setof, &argTypes, &volatility, &comment)
+	if err != nil {
+		return nil, err
 	} else {
-		return &returnType{scalar: false, setof: setof, compositeNames: names, compositeTypes: types}, nil
+		rt := &returnType{scalar: false, setof: setof, compositeNames: names, compositeTypes: types, argTypes: argTypes, volatility: volatility}
+		rt.cacheTTL, rt.annotated = cacheAnnotation(comment)
+		return rt, nil
 	}
 
 }
 
+// getRecordReturnType returns the return type of a function returning
+// record, rt, as a composite type made of its OUT arguments if any
+func (p *PgProc) getRecordReturnType(ctx context.Context, schema string, proc string, nargs int, rt *returnType) (*returnType, error) {
+	query := `
+SELECT
+  coalesce(array_agg(coalesce(nullif(name, ''), 'column' || n) ORDER BY n), '{}'),
+  coalesce(array_agg(typname ORDER BY n), '{}')
+FROM (
+  SELECT args.name, typname, row_number() OVER (ORDER BY args.ord) AS n
+  FROM pg_proc
+  INNER JOIN pg_namespace ON pg_namespace.oid = pg_proc.pronamespace
+  CROSS JOIN LATERAL unnest(proallargtypes, proargmodes, proargnames) WITH ORDINALITY AS args(oid, mode, name, ord)
+  INNER JOIN pg_type ON pg_type.oid = args.oid
+  WHERE
+    nspname = $1 AND
+    proname = $2 AND
+    pronargs = $3 AND
+    args.mode IN ('o', 'b', 't')
+) out_args`
+
+	var names, types pq.StringArray
+	if err := p.db.QueryRowContext(ctx, query, schema, proc, nargs).Scan(&names, &types); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return rt, nil
+	}
+	return &returnType{scalar: false, setof: rt.setof, compositeNames: names, compositeTypes: types, argTypes: rt.argTypes,
+		volatility: rt.volatility, annotated: rt.annotated, cacheTTL: rt.cacheTTL}, nil
+}
+
 // TODO: Optimize with map
 func getFieldByTag(v interface{}, tag string) (string, bool) {
 	t := reflect.TypeOf(v).Elem()
@@ -1,9 +1,12 @@
 package pgproc
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"github.com/lib/pq"
 	"math"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -102,6 +105,36 @@ func TestCallReturnsSetofInteger(t *testing.T) {
 	}
 }
 
+func TestCallClosesChannel(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost")
+	if err != nil {
+		t.Fatalf("Error opening: %s", err)
+	}
+	db.Close()
+	p := &PgProc{db: db}
+	for _, proc := range []string{"test_returns_setof_integer", "_hidden_function"} {
+		ch := make(chan int64)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- p.CallContext(context.Background(), ch, "tests", proc)
+		}()
+		for range ch {
+		}
+		if err := <-errs; err == nil {
+			t.Errorf("Error expected error calling %s", proc)
+		}
+	}
+}
+
+func TestSetofResultCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, add := setofResult(ctx, make(chan int64))
+	if err := add(reflect.ValueOf(int64(1))); err != context.Canceled {
+		t.Errorf("Error expected cancelled send: %v", err)
+	}
+}
+
 func TestCallReturnsIntegerAsString(t *testing.T) {
 	var res string
 	err := base.Call(&res, "tests", "test_returns_integer_as_string")
@@ -314,6 +347,20 @@ func TestCallReturnsComposite(t *testing.T) {
 	}
 }
 
+func TestCallReturnsOutArgs(t *testing.T) {
+	var res struct {
+		C int
+		D string
+	}
+	err := base.Call(&res, "tests", "test_described", 41, "hello")
+	if err != nil {
+		t.Errorf("Error calling tests.test_described: %s", err)
+	}
+	if res.C != 42 || res.D != "hello" {
+		t.Errorf("Error expected value: %+v", res)
+	}
+}
+
 // The order of fields of the struct doo not need to respect
 // order of fields in PostgreSQL composite type
 func TestCallReturnsCompositeRandomOrder(t *testing.T) {
@@ -618,3 +665,70 @@ func TestReturnsJsonUnmarshalled(t *testing.T) {
 	}
 	
 }
+
+func TestCallReturnsSetofIntoSlice(t *testing.T) {
+	var res []int
+	err := base.Call(&res, "tests", "test_returns_setof_integer")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_setof_integer")
+	}
+	if len(res) != 3 || res[0] != 42 || res[1] != 43 || res[2] != 44 {
+		t.Errorf("Error expected values are %v", res)
+	}
+
+	type T struct {
+		A int
+		B string
+	}
+	var items []T
+	err = base.Call(&items, "tests", "test_returns_setof_composite")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_setof_composite")
+	}
+	if len(items) != 2 || items[0].A != 1 || items[1].B != "bye" {
+		t.Errorf("Error expected values are %v", items)
+	}
+}
+
+func TestCallContextCanceled(t *testing.T) {
+	var res int
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := base.CallContext(ctx, &res, "tests", "test_returns_integer")
+	if err == nil {
+		t.Errorf("Error expected an error for a canceled context")
+	}
+}
+
+func TestReturnsIntegerArrayIntoSlice(t *testing.T) {
+	var res []int32
+	err := base.Call(&res, "tests", "test_returns_empty_array")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_empty_array")
+	}
+	if len(res) != 0 {
+		t.Errorf("Error expected empty array")
+	}
+}
+
+func TestScanCompositeRowsFunction(t *testing.T) {
+	rows, err := base.db.Query("SELECT * FROM tests.test_returns_setof_composite()")
+	if err != nil {
+		t.Fatalf("Error querying: %s", err)
+	}
+	defer rows.Close()
+	rt := &returnType{compositeNames: []string{"a", "b"}, compositeTypes: []string{"int4", "varchar"}}
+	type T struct {
+		A int
+		B string
+	}
+	var items []T
+	for rows.Next() {
+		if err := ScanCompositeRows(rows, rt, &items); err != nil {
+			t.Fatalf("Error scanning: %s", err)
+		}
+	}
+	if len(items) != 2 || items[1].B != "bye" {
+		t.Errorf("Error expected values are %v", items)
+	}
+}
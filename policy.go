@@ -0,0 +1,133 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrNotCallable is returned, possibly wrapped, when the call policy
+// forbids to call a function
+var ErrNotCallable = errors.New("function not callable")
+
+// CallPolicy decides if the function proc of schema, with nargs arguments,
+// can be called, and returns an error wrapping ErrNotCallable if not
+type CallPolicy func(ctx context.Context, p *PgProc, schema string, proc string, nargs int) error
+
+// SetCallPolicy sets the policy evaluated before each call,
+// DefaultPolicy if policy is nil.
+// SetCallPolicy must be called before the PgProc is used.
+func (p *PgProc) SetCallPolicy(policy CallPolicy) {
+	p.policy = policy
+}
+
+// Callable evaluates the call policy for the function proc of schema
+// with nargs arguments, as done before each call
+func (p *PgProc) Callable(ctx context.Context, schema string, proc string, nargs int) error {
+	return p.checkPolicy(ctx, schema, proc, nargs)
+}
+
+// checkPolicy evaluates the call policy of p
+func (p *PgProc) checkPolicy(ctx context.Context, schema string, proc string, nargs int) error {
+	policy := p.policy
+	if policy == nil {
+		policy = DefaultPolicy
+	}
+	return policy(ctx, p, schema, proc, nargs)
+}
+
+// DefaultPolicy forbids to call the functions whose name starts with _
+func DefaultPolicy(ctx context.Context, p *PgProc, schema string, proc string, nargs int) error {
+	if proc == "" || proc[0] == '_' {
+		return ErrNotCallable
+	}
+	return nil
+}
+
+// AllPolicies returns a policy allowing a call if all the policies allow it
+func AllPolicies(policies ...CallPolicy) CallPolicy {
+	return func(ctx context.Context, p *PgProc, schema string, proc string, nargs int) error {
+		for _, policy := range policies {
+			if err := policy(ctx, p, schema, proc, nargs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AllowSchemas returns a policy allowing to call the functions of the schemas only
+func AllowSchemas(schemas ...string) CallPolicy {
+	return func(ctx context.Context, p *PgProc, schema string, proc string, nargs int) error {
+		for _, s := range schemas {
+			if s == schema {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: schema %s not allowed", ErrNotCallable, schema)
+	}
+}
+
+// AllowNames returns a policy allowing to call the functions
+// whose name matches the regular expression re
+func AllowNames(re *regexp.Regexp) CallPolicy {
+	return func(ctx context.Context, p *PgProc, schema string, proc string, nargs int) error {
+		if !re.MatchString(proc) {
+			return fmt.Errorf("%w: name %s not allowed", ErrNotCallable, proc)
+		}
+		return nil
+	}
+}
+
+// RequireComment returns a policy allowing to call the functions
+// whose comment (COMMENT ON FUNCTION) contains annotation, @api for example
+func RequireComment(annotation string) CallPolicy {
+	return func(ctx context.Context, p *PgProc, schema string, proc string, nargs int) error {
+		query := `
+SELECT coalesce(obj_description(pg_proc.oid, 'pg_proc'), '')
+FROM pg_proc
+INNER JOIN pg_namespace ON pg_namespace.oid = pg_proc.pronamespace
+WHERE
+  nspname = $1 AND
+  proname = $2 AND
+  pronargs = $3`
+
+		var comment string
+		err := p.db.QueryRowContext(ctx, query, schema, proc, nargs).Scan(&comment)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if !strings.Contains(comment, annotation) {
+			return fmt.Errorf("%w: %s annotation not found", ErrNotCallable, annotation)
+		}
+		return nil
+	}
+}
+
+// RequirePrivilege returns a policy allowing to call the functions
+// role has the EXECUTE privilege on
+func RequirePrivilege(role string) CallPolicy {
+	return func(ctx context.Context, p *PgProc, schema string, proc string, nargs int) error {
+		query := `
+SELECT has_function_privilege($4, pg_proc.oid, 'EXECUTE')
+FROM pg_proc
+INNER JOIN pg_namespace ON pg_namespace.oid = pg_proc.pronamespace
+WHERE
+  nspname = $1 AND
+  proname = $2 AND
+  pronargs = $3`
+
+		var allowed bool
+		err := p.db.QueryRowContext(ctx, query, schema, proc, nargs, role).Scan(&allowed)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("%w: no EXECUTE privilege for %s", ErrNotCallable, role)
+		}
+		return nil
+	}
+}
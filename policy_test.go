@@ -0,0 +1,86 @@
+package pgproc
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	ctx := context.Background()
+	if err := DefaultPolicy(ctx, nil, "tests", "content_get", 1); err != nil {
+		t.Errorf("Error expected content_get callable: %s", err)
+	}
+	if err := DefaultPolicy(ctx, nil, "tests", "_hidden_function", 0); !errors.Is(err, ErrNotCallable) {
+		t.Errorf("Error expected _hidden_function not callable: %v", err)
+	}
+}
+
+func TestAllPolicies(t *testing.T) {
+	ctx := context.Background()
+	policy := AllPolicies(DefaultPolicy, AllowSchemas("tests", "api"), AllowNames(regexp.MustCompile("^content_")))
+	for _, c := range []struct {
+		schema, proc string
+		callable     bool
+	}{
+		{"tests", "content_get", true},
+		{"api", "content_add", true},
+		{"pg_catalog", "content_get", false},
+		{"tests", "pg_sleep", false},
+		{"tests", "_content_get", false},
+	} {
+		err := policy(ctx, nil, c.schema, c.proc, 0)
+		if (err == nil) != c.callable {
+			t.Errorf("Error for %s.%s: %v", c.schema, c.proc, err)
+		}
+		if err != nil && !errors.Is(err, ErrNotCallable) {
+			t.Errorf("Error expected ErrNotCallable for %s.%s: %v", c.schema, c.proc, err)
+		}
+	}
+}
+
+func TestSetCallPolicy(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	p.SetCallPolicy(AllowSchemas("public"))
+	var res int
+	if err := p.Call(&res, "tests", "test_returns_integer"); !errors.Is(err, ErrNotCallable) {
+		t.Errorf("Error expected tests schema not allowed: %v", err)
+	}
+	if err := p.Call(&res, "public", "tests_get_one"); err != nil || res != 1 {
+		t.Errorf("Error calling public.tests_get_one: %v", err)
+	}
+}
+
+func TestRequireComment(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	p.SetCallPolicy(RequireComment("Describes"))
+	if err := p.Call(nil, "tests", "test_described", 1, "x"); err != nil {
+		t.Errorf("Error calling commented function: %s", err)
+	}
+	var i int
+	if err := p.Call(&i, "tests", "test_returns_integer"); !errors.Is(err, ErrNotCallable) {
+		t.Errorf("Error expected uncommented function not callable: %v", err)
+	}
+}
+
+func TestRequirePrivilege(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	p.SetCallPolicy(RequirePrivilege(user))
+	var i int
+	if err := p.Call(&i, "tests", "test_returns_integer"); err != nil {
+		t.Errorf("Error calling with privilege: %s", err)
+	}
+	if err := p.Call(&i, "tests", "unknown_function"); !errors.Is(err, ErrNotCallable) {
+		t.Errorf("Error expected unknown function not callable: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCheckInterval is the default interval between two health checks
+// of the replicas
+const DefaultCheckInterval = 5 * time.Second
+
+// ReplicaOptions configures the routing of the calls to the replicas,
+// see SetReplicas
+type ReplicaOptions struct {
+	// CheckInterval is the interval between two health checks
+	// of the replicas, DefaultCheckInterval if 0
+	CheckInterval time.Duration
+	// MaxLag is the maximum replication lag of the replicas
+	// receiving calls, no limit if 0
+	MaxLag time.Duration
+}
+
+// replica is a read replica of the database
+type replica struct {
+	db *sql.DB
+
+	// version is the server_version_num of the replica, read at the first check
+	version int
+
+	mu      sync.Mutex
+	healthy bool
+	lag     time.Duration
+}
+
+// replicas are the replicas of a PgProc and their health checks
+type replicas struct {
+	options ReplicaOptions
+	list    []*replica
+	next    uint64
+	stop    chan struct{}
+	done    sync.WaitGroup
+}
+
+// SetReplicas sets the read replicas of the database: the calls to
+// the STABLE and IMMUTABLE functions are routed to the healthy replicas
+// whose replication lag is below options.MaxLag, in turn, and the calls to
+// the VOLATILE functions, the calls done in a transaction and the catalog
+// lookups go to the primary, as do all the calls when no replica is available.
+// The replicas are checked at options.CheckInterval until Close is called.
+//
+// SetReplicas must be called before the PgProc is used.
+func (p *PgProc) SetReplicas(options ReplicaOptions, conninfos ...string) error {
+	if options.CheckInterval <= 0 {
+		options.CheckInterval = DefaultCheckInterval
+	}
+	rs := &replicas{options: options, stop: make(chan struct{})}
+	for _, conninfo := range conninfos {
+		db, err := openDB(conninfo, p.location)
+		if err != nil {
+			rs.close()
+			return err
+		}
+		db.SetMaxOpenConns(p.db.Stats().MaxOpenConnections)
+		rs.list = append(rs.list, &replica{db: db})
+	}
+	if p.replicas != nil {
+		p.replicas.close()
+	}
+	p.replicas = rs
+	rs.check()
+	rs.done.Add(1)
+	go rs.run()
+	return nil
+}
+
+// Close stops the health checks of the replicas and the listening to
+// the cache invalidations, and closes the connections to the database
+// and to the replicas
+func (p *PgProc) Close() error {
+	if p.replicas != nil {
+		p.replicas.close()
+	}
+	if p.cache != nil {
+		p.cache.close()
+	}
+	return p.db.Close()
+}
+
+// run checks the replicas at the check interval until close is called
+func (rs *replicas) run() {
+	defer rs.done.Done()
+	ticker := time.NewTicker(rs.options.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+			rs.check()
+		}
+	}
+}
+
+// check checks the replicas concurrently
+func (rs *replicas) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.options.CheckInterval)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, r := range rs.list {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			r.check(ctx)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// check updates the health and the replication lag of the replica:
+// the time since the last replayed transaction, if WAL remains to replay
+func (r *replica) check(ctx context.Context) {
+	var err error
+	if r.version == 0 {
+		err = r.db.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&r.version)
+	}
+	var lag float64
+	if err == nil {
+		err = r.db.QueryRowContext(ctx, lagQuery(r.version)).Scan(&lag)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.healthy = err == nil
+	r.lag = time.Duration(lag * float64(time.Second))
+}
+
+// lagQuery returns the query of the replication lag for a server
+// of the version server_version_num, the functions giving the positions
+// in the WAL being renamed in PostgreSQL 10
+func lagQuery(version int) string {
+	receive, replay := "pg_last_wal_receive_lsn", "pg_last_wal_replay_lsn"
+	if version < 100000 {
+		receive, replay = "pg_last_xlog_receive_location", "pg_last_xlog_replay_location"
+	}
+	return `
+SELECT
+  CASE WHEN NOT pg_is_in_recovery() OR ` + receive + `() = ` + replay + `()
+    THEN 0
+    ELSE coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)
+  END`
+}
+
+// available returns true if the replica can receive calls
+func (r *replica) available(maxLag time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.healthy && (maxLag <= 0 || r.lag <= maxLag)
+}
+
+// pick returns the available replicas in turn, or nil
+func (rs *replicas) pick() *sql.DB {
+	var available []*sql.DB
+	for _, r := range rs.list {
+		if r.available(rs.options.MaxLag) {
+			available = append(available, r.db)
+		}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+	return available[atomic.AddUint64(&rs.next, 1)%uint64(len(available))]
+}
+
+// close stops the health checks and closes the connections to the replicas
+func (rs *replicas) close() {
+	close(rs.stop)
+	rs.done.Wait()
+	for _, r := range rs.list {
+		r.db.Close()
+	}
+}
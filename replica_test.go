@@ -0,0 +1,101 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPickReplica(t *testing.T) {
+	var dbs []*sql.DB
+	rs := &replicas{options: ReplicaOptions{MaxLag: time.Second}}
+	for i, health := range []struct {
+		healthy bool
+		lag     time.Duration
+	}{
+		{true, 0},
+		{false, 0},
+		{true, 2 * time.Second},
+		{true, time.Second},
+	} {
+		db, err := sql.Open("postgres", fmt.Sprintf("dbname=replica%d", i))
+		if err != nil {
+			t.Fatalf("Error opening: %s", err)
+		}
+		defer db.Close()
+		dbs = append(dbs, db)
+		rs.list = append(rs.list, &replica{db: db, healthy: health.healthy, lag: health.lag})
+	}
+	picked := map[*sql.DB]int{}
+	for i := 0; i < 10; i++ {
+		picked[rs.pick()]++
+	}
+	if len(picked) != 2 || picked[dbs[0]] != 5 || picked[dbs[3]] != 5 {
+		t.Errorf("Error expected calls routed to replicas 0 and 3 in turn: %v", picked)
+	}
+
+	rs.options.MaxLag = 0
+	picked = map[*sql.DB]int{}
+	for i := 0; i < 9; i++ {
+		picked[rs.pick()]++
+	}
+	if len(picked) != 3 || picked[dbs[1]] != 0 {
+		t.Errorf("Error expected no lag limit: %v", picked)
+	}
+
+	for _, r := range rs.list {
+		r.healthy = false
+	}
+	if db := rs.pick(); db != nil {
+		t.Errorf("Error expected no replica available")
+	}
+}
+
+func TestSetReplicas(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	defer p.Close()
+	if err := p.SetReplicas(ReplicaOptions{CheckInterval: time.Hour, MaxLag: time.Second}, p.conninfo); err != nil {
+		t.Fatalf("Error setting replicas: %s", err)
+	}
+	r := p.replicas.list[0]
+	if !r.available(time.Second) {
+		t.Fatalf("Error expected healthy replica")
+	}
+	var res int
+	if err := p.Call(&res, "tests", "test_returns_integer"); err != nil || res != 42 {
+		t.Errorf("Error calling on replica: %d %v", res, err)
+	}
+	if r.db.Stats().OpenConnections == 0 {
+		t.Errorf("Error expected immutable function called on replica")
+	}
+	r.db.SetMaxIdleConns(0)
+	if err := p.Call(&res, "tests", "content_add", "on primary"); err != nil {
+		t.Errorf("Error calling on primary: %s", err)
+	}
+	if r.db.Stats().OpenConnections != 0 {
+		t.Errorf("Error expected volatile function called on primary")
+	}
+	r.db.SetMaxIdleConns(2)
+	ctx := WithApplicationName(context.Background(), "replica test")
+	if err := p.CallContext(ctx, &res, "tests", "test_returns_integer"); err != nil || res != 42 {
+		t.Errorf("Error calling on replica with an application name: %d %v", res, err)
+	}
+	if r.db.Stats().OpenConnections == 0 {
+		t.Errorf("Error expected transaction opened on replica")
+	}
+}
+
+func TestLagQuery(t *testing.T) {
+	if q := lagQuery(90600); !strings.Contains(q, "pg_last_xlog_receive_location() = pg_last_xlog_replay_location()") {
+		t.Errorf("Error in query for PostgreSQL 9.6: %s", q)
+	}
+	if q := lagQuery(100000); !strings.Contains(q, "pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn()") {
+		t.Errorf("Error in query for PostgreSQL 10: %s", q)
+	}
+}
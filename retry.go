@@ -0,0 +1,143 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// RetrySQLStates are the SQLSTATEs retried by default:
+// serialization_failure and deadlock_detected
+var RetrySQLStates = []string{"40001", "40P01"}
+
+// RetryPolicy is the policy of the retries of the calls failing with
+// a transient error, see SetRetryPolicy
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a call,
+	// including the first one
+	MaxAttempts int
+	// Backoff is the maximum delay before the first retry, doubled at each
+	// retry up to MaxBackoff; the actual delay is random between 0 and it
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// SQLStates are the SQLSTATEs of the errors to retry, RetrySQLStates if nil
+	SQLStates []string
+	// Safe decides if a call can be retried, SafeToRetry if nil
+	Safe func(ctx context.Context, p *PgProc, schema string, proc string, nargs int) bool
+}
+
+// SetRetryPolicy sets the policy of the retries of the calls and of the
+// WithTx blocks, which are not retried without policy. A call is retried
+// only if it is safe to retry, and no result has been stored yet; a call
+// done in a WithTx block is not retried by itself.
+// SetRetryPolicy must be called before the PgProc is used.
+func (p *PgProc) SetRetryPolicy(policy RetryPolicy) {
+	p.retryPolicy = &policy
+}
+
+type retryKey struct{}
+
+// WithRetry returns a copy of ctx marking the calls and the WithTx blocks
+// done with it as safe to retry
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+// retryMarked returns true if ctx has been returned by WithRetry
+func retryMarked(ctx context.Context) bool {
+	marked, _ := ctx.Value(retryKey{}).(bool)
+	return marked
+}
+
+// SafeToRetry decides that the functions which are not VOLATILE, or whose
+// comment (COMMENT ON FUNCTION) contains the @retry annotation,
+// are safe to retry
+func SafeToRetry(ctx context.Context, p *PgProc, schema string, proc string, nargs int) bool {
+	query := `
+SELECT
+  provolatile,
+  coalesce(obj_description(pg_proc.oid, 'pg_proc'), '')
+FROM pg_proc
+INNER JOIN pg_namespace ON pg_namespace.oid = pg_proc.pronamespace
+WHERE
+  nspname = $1 AND
+  proname = $2 AND
+  pronargs = $3`
+
+	var volatility, comment string
+	if err := p.db.QueryRowContext(ctx, query, schema, proc, nargs).Scan(&volatility, &comment); err != nil {
+		return false
+	}
+	return volatility != "v" || strings.Contains(comment, "@retry")
+}
+
+// safeToRetry returns true if the call of the function proc of schema,
+// with nargs arguments, done with ctx, can be retried
+func (p *PgProc) safeToRetry(ctx context.Context, schema string, proc string, nargs int) bool {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		// the transaction is aborted, the whole block must be retried
+		return false
+	}
+	if retryMarked(ctx) {
+		return true
+	}
+	safe := p.retryPolicy.Safe
+	if safe == nil {
+		safe = SafeToRetry
+	}
+	return safe(ctx, p, schema, proc, nargs)
+}
+
+// retryable returns true if err is to be retried
+func (r *RetryPolicy) retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := sqlState(err)
+	states := r.SQLStates
+	if states == nil {
+		states = RetrySQLStates
+	}
+	for _, state := range states {
+		if code == state {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the retry following attempt
+func (r *RetryPolicy) backoff(attempt int) time.Duration {
+	max := r.Backoff
+	for i := 1; i < attempt && (r.MaxBackoff <= 0 || max < r.MaxBackoff); i++ {
+		max *= 2
+	}
+	if r.MaxBackoff > 0 && max > r.MaxBackoff {
+		max = r.MaxBackoff
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+// withRetries calls attempt, and calls it again according to the retry
+// policy of p while it fails with a retryable error and safe, called
+// before each retry, returns true
+func (p *PgProc) withRetries(ctx context.Context, safe func() bool, attempt func() error) error {
+	err := attempt()
+	r := p.retryPolicy
+	for n := 1; r != nil && n < r.MaxAttempts && r.retryable(err) && safe(); n++ {
+		timer := time.NewTimer(r.backoff(n))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = attempt()
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestRetryable(t *testing.T) {
+	r := RetryPolicy{}
+	for _, c := range []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{errors.New("failed"), false},
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "40P01"}, true},
+		{&pq.Error{Code: "23505"}, false},
+	} {
+		if r.retryable(c.err) != c.expected {
+			t.Errorf("Error retryable %v: expected %v", c.err, c.expected)
+		}
+	}
+	r.SQLStates = []string{"23505"}
+	if r.retryable(&pq.Error{Code: "40001"}) || !r.retryable(&pq.Error{Code: "23505"}) {
+		t.Errorf("Error expected custom SQLSTATEs")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 25 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if d := r.backoff(1); d < 0 || d > 10*time.Millisecond {
+			t.Fatalf("Error backoff of first retry: %s", d)
+		}
+		if d := r.backoff(5); d < 0 || d > 25*time.Millisecond {
+			t.Fatalf("Error backoff limited by MaxBackoff: %s", d)
+		}
+	}
+	if d := (&RetryPolicy{}).backoff(3); d != 0 {
+		t.Errorf("Error expected no backoff: %s", d)
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	var p PgProc
+	attempts := 0
+	failing := func() error {
+		attempts++
+		return &pq.Error{Code: "40001"}
+	}
+	safe := func() bool { return true }
+
+	// without policy
+	p.withRetries(context.Background(), safe, failing)
+	if attempts != 1 {
+		t.Errorf("Error expected 1 attempt: %d", attempts)
+	}
+
+	p.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	attempts = 0
+	if err := p.withRetries(context.Background(), safe, failing); sqlState(err) != "40001" || attempts != 3 {
+		t.Errorf("Error expected 3 attempts: %d %v", attempts, err)
+	}
+	attempts = 0
+	p.withRetries(context.Background(), func() bool { return false }, failing)
+	if attempts != 1 {
+		t.Errorf("Error expected unsafe call not retried: %d", attempts)
+	}
+	attempts = 0
+	err := p.withRetries(context.Background(), safe, func() error {
+		attempts++
+		if attempts == 1 {
+			return &pq.Error{Code: "40P01"}
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("Error expected success at second attempt: %d %v", attempts, err)
+	}
+	attempts = 0
+	p.withRetries(context.Background(), safe, func() error {
+		attempts++
+		return &pq.Error{Code: "23505"}
+	})
+	if attempts != 1 {
+		t.Errorf("Error expected non retryable error not retried: %d", attempts)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	p.withRetries(ctx, safe, failing)
+	if attempts != 1 {
+		t.Errorf("Error expected no retry after cancel: %d", attempts)
+	}
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	var tracer recordingTracer
+	p.SetTracer(&tracer)
+	p.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	var n int
+	if err := p.Call(&n, "tests", "test_fails_once"); err != nil {
+		t.Errorf("Error expected retried call to succeed: %s", err)
+	}
+
+	// volatile function without @retry annotation
+	tracer.spans = nil
+	if err := p.Call(&n, "tests", "test_fails_always"); sqlState(err) != "40P01" {
+		t.Errorf("Error expected deadlock: %v", err)
+	}
+	if attempts := tracer.spans[2].attributes["pgproc.attempts"]; attempts != 1 {
+		t.Errorf("Error expected 1 attempt: %v", attempts)
+	}
+	tracer.spans = nil
+	if err := p.CallContext(WithRetry(context.Background()), &n, "tests", "test_fails_always"); sqlState(err) != "40P01" {
+		t.Errorf("Error expected deadlock: %v", err)
+	}
+	if attempts := tracer.spans[2].attributes["pgproc.attempts"]; attempts != 3 {
+		t.Errorf("Error expected 3 attempts: %v", attempts)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	var id int
+	err = p.WithTx(context.Background(), nil, func(ctx context.Context) error {
+		if err := p.CallContext(ctx, &id, "tests", "content_add", "in tx"); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Fatalf("Error expected rollback: %v", err)
+	}
+	var item Content
+	if err := p.Call(&item, "tests", "content_get", id); err == nil && item.CntId == id {
+		t.Errorf("Error expected content rolled back: %+v", item)
+	}
+
+	p.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	runs := 0
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	err = p.WithTx(WithRetry(context.Background()), opts, func(ctx context.Context) error {
+		runs++
+		var n int
+		return p.CallContext(ctx, &n, "tests", "test_fails_once")
+	})
+	if err != nil || runs > 2 {
+		t.Errorf("Error expected retried block to succeed: %d %v", runs, err)
+	}
+}
@@ -0,0 +1,133 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// session holds the role and the settings of the calls done with a context
+type session struct {
+	role     string
+	settings map[string]string
+}
+
+type sessionKey struct{}
+
+// WithSession returns a copy of ctx making the calls done with it run in
+// a transaction, under role if not empty (SET LOCAL ROLE), and with the
+// configuration parameters settings set locally, for the procedures to read
+// them with current_setting, and row-level security policies to use them:
+//
+//	ctx = pgproc.WithSession(ctx, "web_user", map[string]string{"request.user_id": "42"})
+//	err := base.CallContext(ctx, &res, "api", "my_orders")
+func WithSession(ctx context.Context, role string, settings map[string]string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{role: role, settings: settings})
+}
+
+type txKey struct{}
+
+// WithTx runs fn in a transaction started with opts, committed if fn
+// returns nil and rolled back otherwise: the calls done with the context
+// passed to fn run in the transaction, configured for the session and
+// the application name of ctx. When ctx is already in a transaction,
+// fn runs in it.
+//
+//	err := base.WithTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(ctx context.Context) error {
+//		if err := base.CallContext(ctx, nil, "api", "debit", from, amount); err != nil {
+//			return err
+//		}
+//		return base.CallContext(ctx, nil, "api", "credit", to, amount)
+//	})
+//
+// With a context returned by WithRetry, the whole block is retried on the
+// errors of the retry policy, and fn must be safe to run several times.
+func (p *PgProc) WithTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+	safe := func() bool {
+		return retryMarked(ctx)
+	}
+	return p.withRetries(ctx, safe, func() error {
+		tx, end, err := p.beginTx(ctx, p.db, opts)
+		if err != nil {
+			return err
+		}
+		return end(fn(context.WithValue(ctx, txKey{}, tx)))
+	})
+}
+
+// begin returns the querier to run a call with, and the function to call
+// with the error of the call once done: the transaction of WithTx,
+// or the database, a replica for a readOnly call or p.db, or
+// a transaction on it configured for the session and the application
+// name of ctx, committed or rolled back at the end
+func (p *PgProc) begin(ctx context.Context, readOnly bool) (querier, func(error) error, error) {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx, func(err error) error { return err }, nil
+	}
+	db := p.db
+	if readOnly && p.replicas != nil {
+		if replica := p.replicas.pick(); replica != nil {
+			db = replica
+		}
+	}
+	s, _ := ctx.Value(sessionKey{}).(*session)
+	if s == nil && p.applicationNameOf(ctx) == "" {
+		return db, func(err error) error { return err }, nil
+	}
+	return p.beginTx(ctx, db, nil)
+}
+
+// beginTx starts a transaction on db configured for the session and the
+// application name of ctx, and returns it with the function committing
+// or rolling it back depending on the error given
+func (p *PgProc) beginTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*sql.Tx, func(error) error, error) {
+	s, _ := ctx.Value(sessionKey{}).(*session)
+	if s == nil {
+		s = &session{}
+	}
+	applicationName := p.applicationNameOf(ctx)
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	end := func(err error) error {
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+	if applicationName != "" {
+		if _, err := tx.ExecContext(ctx, "SELECT set_config('application_name', $1, true)", applicationName); err != nil {
+			return nil, nil, end(err)
+		}
+	}
+	if s.role != "" {
+		if _, err := tx.ExecContext(ctx, "SET LOCAL ROLE "+pq.QuoteIdentifier(s.role)); err != nil {
+			return nil, nil, end(err)
+		}
+	}
+	names := make([]string, 0, len(s.settings))
+	for name := range s.settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := tx.ExecContext(ctx, "SELECT set_config($1, $2, true)", name, s.settings[name]); err != nil {
+			return nil, nil, end(err)
+		}
+	}
+	return tx, end, nil
+}
@@ -0,0 +1,44 @@
+package pgproc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithSession(t *testing.T) {
+	ctx := WithSession(context.Background(), user, map[string]string{"request.claims": `{"sub":"42"}`})
+	var claims string
+	if err := base.CallContext(ctx, &claims, "tests", "test_current_setting", "request.claims"); err != nil {
+		t.Fatalf("Error calling with session: %s", err)
+	}
+	if claims != `{"sub":"42"}` {
+		t.Errorf("Error expected claims setting, got %s", claims)
+	}
+	var role string
+	if err := base.CallContext(ctx, &role, "tests", "test_current_user"); err != nil || role != user {
+		t.Errorf("Error expected role %s, got %s %v", user, role, err)
+	}
+}
+
+func TestSessionSettingsAreLocal(t *testing.T) {
+	ctx := WithSession(context.Background(), "", map[string]string{"request.claims": "local"})
+	var setting string
+	if err := base.CallContext(ctx, &setting, "tests", "test_current_setting", "request.claims"); err != nil || setting != "local" {
+		t.Errorf("Error calling with session: %s %v", setting, err)
+	}
+	var after *string
+	if err := base.Call(&after, "tests", "test_current_setting", "request.claims"); err != nil {
+		t.Fatalf("Error calling without session: %s", err)
+	}
+	if after != nil && *after != "" {
+		t.Errorf("Error expected setting reset after the transaction, got %s", *after)
+	}
+}
+
+func TestSessionUnknownRole(t *testing.T) {
+	ctx := WithSession(context.Background(), "pgproc_unknown_role", nil)
+	var i int
+	if err := base.CallContext(ctx, &i, "tests", "test_returns_integer"); err == nil {
+		t.Errorf("Error expected calling under an unknown role")
+	}
+}
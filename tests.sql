@@ -77,6 +77,161 @@ BEGIN
 END;
 $$;
 
+CREATE FUNCTION tests.test_returns_big_numeric()
+RETURNS numeric
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT 12345678901234567890.123456789012345678::numeric;
+$$;
+
+CREATE FUNCTION tests.test_returns_numeric_nan()
+RETURNS numeric
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT 'NaN'::numeric;
+$$;
+
+CREATE FUNCTION tests.test_returns_numeric_array()
+RETURNS numeric[]
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT ARRAY[1.5, NULL, 2.25]::numeric[];
+$$;
+
+CREATE FUNCTION tests.test_returns_same_numeric_array(list numeric[])
+RETURNS numeric[]
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT $1;
+$$;
+
+CREATE TYPE tests.invoice AS (
+  inv_id integer,
+  inv_amount numeric,
+  inv_lines numeric[]
+);
+
+CREATE FUNCTION tests.test_returns_invoice()
+RETURNS tests.invoice
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT (1, 10.10, ARRAY[4.05, 6.05])::tests.invoice;
+$$;
+
+CREATE TYPE tests.device AS (
+  dev_id uuid,
+  dev_address inet,
+  dev_network cidr,
+  dev_mac macaddr
+);
+
+CREATE FUNCTION tests.test_returns_uuid()
+RETURNS uuid
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT 'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11'::uuid;
+$$;
+
+CREATE FUNCTION tests.test_returns_same_uuid(u uuid)
+RETURNS uuid
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT $1;
+$$;
+
+CREATE FUNCTION tests.test_returns_uuid_array()
+RETURNS uuid[]
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT ARRAY['a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11',
+               '00000000-0000-0000-0000-000000000001']::uuid[];
+$$;
+
+CREATE FUNCTION tests.test_returns_same_inet(i inet)
+RETURNS inet
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT $1;
+$$;
+
+CREATE FUNCTION tests.test_returns_setof_inet()
+RETURNS SETOF inet
+LANGUAGE PLPGSQL
+IMMUTABLE
+AS $$
+BEGIN
+  RETURN NEXT '192.168.0.1'::inet;
+  RETURN NEXT '2001:db8::1'::inet;
+END;
+$$;
+
+CREATE FUNCTION tests.test_returns_inet_array(list inet[])
+RETURNS inet[]
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT $1;
+$$;
+
+CREATE FUNCTION tests.test_returns_device()
+RETURNS tests.device
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT ('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11', '10.0.0.5/8',
+          '10.0.0.0/8', '08:00:2b:01:02:03')::tests.device;
+$$;
+
+CREATE TYPE tests.place AS (
+  plc_name text,
+  plc_location point,
+  plc_area point[]
+);
+
+CREATE FUNCTION tests.test_returns_same_point(p point)
+RETURNS point
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT $1;
+$$;
+
+CREATE FUNCTION tests.test_returns_setof_point()
+RETURNS SETOF point
+LANGUAGE PLPGSQL
+IMMUTABLE
+AS $$
+BEGIN
+  RETURN NEXT point(1, 2);
+  RETURN NEXT point(3.5, -4);
+END;
+$$;
+
+CREATE FUNCTION tests.test_returns_point_array(list point[])
+RETURNS point[]
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT $1;
+$$;
+
+CREATE FUNCTION tests.test_returns_place()
+RETURNS tests.place
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT ('home', point(1, 2), ARRAY[point(0, 0), point(2, 4)])::tests.place;
+$$;
+
 CREATE FUNCTION tests.test_returns_real()
 RETURNS real
 LANGUAGE SQL
@@ -149,6 +304,30 @@ AS $$
   SELECT '-infinity'::date;
 $$;
 
+CREATE FUNCTION tests.test_returns_infinity_timestamp()
+RETURNS timestamp
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT 'infinity'::timestamp;
+$$;
+
+CREATE FUNCTION tests.test_returns_timestamp_array()
+RETURNS timestamp[]
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT ARRAY['-infinity', '2015-01-01 10:00:00', NULL]::timestamp[];
+$$;
+
+CREATE FUNCTION tests.test_is_finite_date(d date)
+RETURNS boolean
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT isfinite($1);
+$$;
+
 CREATE FUNCTION tests.test_returns_64bits_date()
 RETURNS date
 LANGUAGE SQL
@@ -322,6 +501,30 @@ AS $$
   SELECT $1;
 $$;
 
+CREATE FUNCTION tests.test_returns_same_timestamptz(t timestamptz)
+RETURNS timestamptz
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT $1;
+$$;
+
+CREATE FUNCTION tests.test_returns_timestamptz_as_text(t timestamptz)
+RETURNS text
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT $1::text;
+$$;
+
+CREATE FUNCTION tests.test_returns_same_timetz(t timetz)
+RETURNS timetz
+LANGUAGE SQL
+IMMUTABLE
+AS $$
+  SELECT $1;
+$$;
+
 CREATE FUNCTION tests.test_integer_array_arg(list integer[]) 
 RETURNS SETOF integer
 LANGUAGE plpgsql
@@ -417,6 +620,66 @@ BEGIN
 END;
 $$;
 
+CREATE FUNCTION tests.test_described(a integer, b text DEFAULT 'none', OUT c integer, OUT d text)
+LANGUAGE SQL
+STABLE
+STRICT
+SECURITY DEFINER
+AS $$
+  SELECT a + 1, b;
+$$;
+COMMENT ON FUNCTION tests.test_described(integer, text) IS 'Describes the arguments';
+
+CREATE FUNCTION tests.test_current_setting(name text)
+RETURNS text
+LANGUAGE SQL
+STABLE
+AS $$
+  SELECT current_setting(name, true);
+$$;
+
+CREATE FUNCTION tests.test_current_user()
+RETURNS text
+LANGUAGE SQL
+STABLE
+AS $$
+  SELECT current_user::text;
+$$;
+
+CREATE FUNCTION tests.test_current_query()
+RETURNS text
+LANGUAGE SQL
+STABLE
+AS $$
+  SELECT current_query();
+$$;
+
+CREATE SEQUENCE tests.test_attempts;
+
+CREATE FUNCTION tests.test_fails_once()
+RETURNS integer
+LANGUAGE plpgsql
+VOLATILE
+AS $$
+BEGIN
+  IF nextval('tests.test_attempts') % 2 = 1 THEN
+    RAISE EXCEPTION 'could not serialize access' USING ERRCODE = 'serialization_failure';
+  END IF;
+  RETURN currval('tests.test_attempts');
+END;
+$$;
+COMMENT ON FUNCTION tests.test_fails_once() IS 'Fails every other call @retry';
+
+CREATE FUNCTION tests.test_fails_always()
+RETURNS integer
+LANGUAGE plpgsql
+VOLATILE
+AS $$
+BEGIN
+  RAISE EXCEPTION 'deadlock' USING ERRCODE = 'deadlock_detected';
+END;
+$$;
+
 DROP FUNCTION IF EXISTS public.tests_get_one();
 CREATE FUNCTION public.tests_get_one()
 RETURNS integer
@@ -445,4 +708,15 @@ BEGIN
 END;
 $$;
 
+CREATE FUNCTION tests.test_annotated_cache()
+RETURNS integer
+LANGUAGE plpgsql
+STABLE
+AS $$
+BEGIN
+  RETURN nextval('tests.test_attempts');
+END;
+$$;
+COMMENT ON FUNCTION tests.test_annotated_cache() IS 'Counts its calls @cache ttl=1h';
+
 COMMIT;
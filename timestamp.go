@@ -0,0 +1,173 @@
+package pgproc
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrInfinity is returned when an infinite date or timestamp is read into
+// a time.Time after a call to SetInfinityError
+var ErrInfinity = errors.New("date or timestamp value is infinite")
+
+// InfinityModifier tells if a Timestamp is finite or infinite
+type InfinityModifier int8
+
+const (
+	NegativeInfinity InfinityModifier = -1
+	Finite           InfinityModifier = 0
+	Infinity         InfinityModifier = 1
+)
+
+func (m InfinityModifier) String() string {
+	switch m {
+	case NegativeInfinity:
+		return "-infinity"
+	case Infinity:
+		return "infinity"
+	}
+	return "finite"
+}
+
+// Timestamp is a nullable date or timestamp value which can be infinite.
+// Time is meaningful only if Valid is true and InfinityModifier is Finite.
+type Timestamp struct {
+	Time             time.Time
+	InfinityModifier InfinityModifier
+	Valid            bool
+}
+
+// Scan implements the sql.Scanner interface
+func (ts *Timestamp) Scan(src interface{}) error {
+	*ts = Timestamp{}
+	switch s := src.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		ts.Time = s
+	default:
+		text, err := textOf(src)
+		if err != nil {
+			return err
+		}
+		if ts.InfinityModifier = infinityModifierOf(text); ts.InfinityModifier == Finite {
+			if ts.Time, err = pq.ParseTimestamp(nil, text); err != nil {
+				return err
+			}
+		}
+	}
+	ts.Valid = true
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (ts Timestamp) Value() (driver.Value, error) {
+	if !ts.Valid {
+		return nil, nil
+	}
+	if ts.InfinityModifier != Finite {
+		return ts.InfinityModifier.String(), nil
+	}
+	return ts.Time, nil
+}
+
+// infinity defines how a PgProc maps infinite dates and timestamps
+// to and from time.Time values
+type infinity struct {
+	errors   bool
+	negative time.Time
+	positive time.Time
+}
+
+// SetInfinity maps infinite dates and timestamps to negative and positive
+// when they are read into time.Time values. Parameters before or equal to
+// negative, and after or equal to positive, are sent as infinite values.
+// The defaults are DateMinusInfinity and DateInfinity.
+func (p *PgProc) SetInfinity(negative time.Time, positive time.Time) error {
+	if !negative.Before(positive) {
+		return errors.New("negative infinity must be before positive infinity")
+	}
+	p.infinity = infinity{negative: negative, positive: positive}
+	return nil
+}
+
+// SetInfinityError makes calls return ErrInfinity when an infinite date or
+// timestamp is read into a time.Time value; time.Time parameters are always
+// sent as finite values. Use Timestamp to read infinite values.
+func (p *PgProc) SetInfinityError() {
+	p.infinity = infinity{errors: true}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// timeDecoder returns a decodeFunc storing a date or time value
+// into a time.Time, or nil for other types
+func (p *PgProc) timeDecoder(t reflect.Type, typname string) decodeFunc {
+	if t != timeType {
+		return nil
+	}
+	switch typname {
+	case "date", "timestamp", "timestamptz", "time", "timetz":
+		return func(dest reflect.Value, src interface{}) error {
+			return p.decodeTime(dest, src, typname)
+		}
+	}
+	return nil
+}
+
+func (p *PgProc) decodeTime(dest reflect.Value, src interface{}, typname string) error {
+	if src == nil {
+		return setNull(dest)
+	}
+	var ts Timestamp
+	if typname == "time" || typname == "timetz" {
+		t, err := parseTimeOfDay(src, typname)
+		if err != nil {
+			return err
+		}
+		ts = Timestamp{Time: t, Valid: true}
+	} else if err := ts.Scan(src); err != nil {
+		return err
+	}
+	if ts.InfinityModifier != Finite && p.infinity.errors {
+		return ErrInfinity
+	}
+	switch ts.InfinityModifier {
+	case NegativeInfinity:
+		ts.Time = p.infinity.negative
+	case Infinity:
+		ts.Time = p.infinity.positive
+	default:
+		ts.Time = p.localize(ts.Time, typname)
+	}
+	dest.Set(reflect.ValueOf(ts.Time))
+	return nil
+}
+
+// encodeTime returns the value to send for the time.Time parameter t,
+// for an argument of the PostgreSQL type typname
+func (p *PgProc) encodeTime(t time.Time, typname string) interface{} {
+	if !p.infinity.errors && typname != "time" && typname != "timetz" {
+		if !t.After(p.infinity.negative) {
+			return NegativeInfinity.String()
+		}
+		if !t.Before(p.infinity.positive) {
+			return Infinity.String()
+		}
+	}
+	return p.formatTime(t, typname)
+}
+
+// infinityModifierOf returns the InfinityModifier of the textual form of a date or timestamp
+func infinityModifierOf(text string) InfinityModifier {
+	switch text {
+	case "-infinity":
+		return NegativeInfinity
+	case "infinity":
+		return Infinity
+	}
+	return Finite
+}
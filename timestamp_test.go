@@ -0,0 +1,120 @@
+package pgproc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimestampScan(t *testing.T) {
+	var ts Timestamp
+	if err := ts.Scan([]byte("infinity")); err != nil || !ts.Valid || ts.InfinityModifier != Infinity {
+		t.Errorf("Error expected infinity value is %v", ts)
+	}
+	if err := ts.Scan(nil); err != nil || ts.Valid {
+		t.Errorf("Error expected NULL value is %v", ts)
+	}
+	if err := ts.Scan("2015-01-01 10:00:00"); err != nil || !ts.Valid ||
+		ts.InfinityModifier != Finite || ts.Time.Year() != 2015 || ts.Time.Hour() != 10 {
+		t.Errorf("Error expected 2015-01-01 10:00:00 value is %v", ts)
+	}
+	if v, _ := (Timestamp{Valid: true, InfinityModifier: NegativeInfinity}).Value(); v != "-infinity" {
+		t.Errorf("Error expected -infinity value is %v", v)
+	}
+}
+
+func TestSetInfinity(t *testing.T) {
+	p, _ := connect()
+	negative := time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+	positive := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := p.SetInfinity(positive, negative); err == nil {
+		t.Errorf("Error expected an error for inverted infinities")
+	}
+	if err := p.SetInfinity(negative, positive); err != nil {
+		t.Errorf("Error setting infinities")
+	}
+
+	var res time.Time
+	err := p.Call(&res, "tests", "test_returns_infinity_timestamp")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_infinity_timestamp")
+	}
+	if !res.Equal(positive) {
+		t.Errorf("Error expected %s value is %s", positive, res)
+	}
+
+	var finite bool
+	err = p.Call(&finite, "tests", "test_is_finite_date", negative)
+	if err != nil {
+		t.Errorf("Error calling tests.test_is_finite_date")
+	}
+	if finite {
+		t.Errorf("Error expected an infinite date")
+	}
+
+	// other instances are not affected
+	err = base.Call(&res, "tests", "test_returns_infinity_timestamp")
+	if err != nil || res != DateInfinity {
+		t.Errorf("Error expected %s value is %s", DateInfinity, res)
+	}
+}
+
+func TestSetInfinityError(t *testing.T) {
+	p, _ := connect()
+	p.SetInfinityError()
+
+	var res time.Time
+	err := p.Call(&res, "tests", "test_returns_minus_infinity_date")
+	if !errors.Is(err, ErrInfinity) {
+		t.Errorf("Error expected ErrInfinity")
+	}
+
+	var ts Timestamp
+	err = p.Call(&ts, "tests", "test_returns_minus_infinity_date")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_minus_infinity_date")
+	}
+	if !ts.Valid || ts.InfinityModifier != NegativeInfinity {
+		t.Errorf("Error expected -infinity value is %v", ts)
+	}
+}
+
+func TestInfinityArg(t *testing.T) {
+	var finite bool
+	err := base.Call(&finite, "tests", "test_is_finite_date", Timestamp{Valid: true, InfinityModifier: Infinity})
+	if err != nil {
+		t.Errorf("Error calling tests.test_is_finite_date")
+	}
+	if finite {
+		t.Errorf("Error expected an infinite date")
+	}
+
+	err = base.Call(&finite, "tests", "test_is_finite_date", DateInfinity)
+	if err != nil {
+		t.Errorf("Error calling tests.test_is_finite_date")
+	}
+	if finite {
+		t.Errorf("Error expected an infinite date")
+	}
+}
+
+func TestCallReturnsTimestampArray(t *testing.T) {
+	var res []Timestamp
+	err := base.Call(&res, "tests", "test_returns_timestamp_array")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_timestamp_array")
+	}
+	if len(res) != 3 || res[0].InfinityModifier != NegativeInfinity ||
+		res[1].Time.Year() != 2015 || res[2].Valid {
+		t.Errorf("Error expected values are %v", res)
+	}
+
+	var times []*time.Time
+	err = base.Call(&times, "tests", "test_returns_timestamp_array")
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_timestamp_array")
+	}
+	if len(times) != 3 || *times[0] != DateMinusInfinity || times[1].Year() != 2015 || times[2] != nil {
+		t.Errorf("Error expected values are %v", times)
+	}
+}
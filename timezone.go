@@ -0,0 +1,117 @@
+package pgproc
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SetLocation sets the TimeZone of the database sessions to the name
+// of loc and returns date and time results in loc:
+// timestamptz values are converted to loc, and the values of timestamp,
+// date, time and timetz are interpreted as wall clock times in loc.
+// time.Time parameters are converted to loc before being sent as date,
+// timestamp or time arguments.
+//
+// SetLocation reopens the connections to the database and must be called
+// before the PgProc is used, and before SetReplicas for the replicas to
+// use the same TimeZone.
+func (p *PgProc) SetLocation(loc *time.Location) error {
+	if loc == nil || loc.String() == "Local" {
+		return errors.New("location must have an IANA time zone name")
+	}
+	if p.replicas != nil {
+		return errors.New("location must be set before the replicas")
+	}
+	db, err := openDB(p.conninfo, loc)
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(p.db.Stats().MaxOpenConnections)
+	p.db.Close()
+	p.db = db
+	p.location = loc
+	return nil
+}
+
+// openDB opens a database, with the TimeZone of the sessions set
+// to the name of loc if not nil
+func openDB(conninfo string, loc *time.Location) (*sql.DB, error) {
+	if loc == nil {
+		return sql.Open("postgres", conninfo)
+	}
+	cfg, err := pq.NewConfig(conninfo)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Runtime == nil {
+		cfg.Runtime = map[string]string{}
+	}
+	cfg.Runtime["TimeZone"] = loc.String()
+	connector, err := pq.NewConnectorConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+// localize returns t, read from a value of the PostgreSQL type typname,
+// in the location of p
+func (p *PgProc) localize(t time.Time, typname string) time.Time {
+	if p.location == nil {
+		return t
+	}
+	switch typname {
+	case "timestamptz":
+		return t.In(p.location)
+	case "timetz":
+		// a time of day has no date, use the current offset of the location
+		name, offset := time.Now().In(p.location).Zone()
+		return t.In(time.FixedZone(name, offset))
+	case "date":
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, p.location)
+	}
+	y, m, d := t.Date()
+	return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), p.location)
+}
+
+// formatTime returns the textual form of t for an argument of the PostgreSQL type typname
+func (p *PgProc) formatTime(t time.Time, typname string) interface{} {
+	if p.location != nil {
+		t = t.In(p.location)
+	}
+	switch typname {
+	case "date":
+		return t.Format("2006-01-02")
+	case "timestamp":
+		return t.Format("2006-01-02 15:04:05.999999")
+	case "time":
+		return t.Format("15:04:05.999999")
+	case "timetz":
+		return t.Format("15:04:05.999999-07:00")
+	}
+	return t
+}
+
+// parseTimeOfDay parses a time or timetz value
+func parseTimeOfDay(src interface{}, typname string) (time.Time, error) {
+	if t, ok := src.(time.Time); ok {
+		return t, nil
+	}
+	text, err := textOf(src)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if typname == "time" {
+		return time.Parse("15:04:05.999999999", text)
+	}
+	for _, layout := range []string{"15:04:05.999999999-07", "15:04:05.999999999-07:00", "15:04:05.999999999-07:00:00"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid timetz value '" + text + "'")
+}
@@ -0,0 +1,123 @@
+package pgproc
+
+import (
+	"testing"
+	"time"
+)
+
+func loadParis(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("Europe/Paris time zone not available")
+	}
+	return loc
+}
+
+func TestFormatTime(t *testing.T) {
+	p := &PgProc{location: loadParis(t)}
+	input := time.Date(2017, 5, 9, 22, 30, 0, 0, time.UTC)
+	if res := p.formatTime(input, "date"); res != "2017-05-10" {
+		t.Errorf("Error expected 2017-05-10 value is %v", res)
+	}
+	if res := p.formatTime(input, "timestamp"); res != "2017-05-10 00:30:00" {
+		t.Errorf("Error expected 2017-05-10 00:30:00 value is %v", res)
+	}
+	if res := p.formatTime(input, "time"); res != "00:30:00" {
+		t.Errorf("Error expected 00:30:00 value is %v", res)
+	}
+	if res := p.formatTime(input, "timestamptz").(time.Time); !res.Equal(input) {
+		t.Errorf("Error expected %s value is %v", input, res)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	paris := loadParis(t)
+	p := &PgProc{location: paris}
+	input := time.Date(2017, 5, 9, 22, 30, 0, 0, time.UTC)
+	if res := p.localize(input, "timestamp"); !res.Equal(time.Date(2017, 5, 9, 22, 30, 0, 0, paris)) {
+		t.Errorf("Error expected wall clock in Europe/Paris value is %s", res)
+	}
+	if res := p.localize(input, "timestamptz"); !res.Equal(input) || res.Location() != paris {
+		t.Errorf("Error expected same instant in Europe/Paris value is %s", res)
+	}
+	if res := p.localize(input, "date"); !res.Equal(time.Date(2017, 5, 9, 0, 0, 0, 0, paris)) {
+		t.Errorf("Error expected midnight in Europe/Paris value is %s", res)
+	}
+}
+
+func TestSetLocationAfterReplicas(t *testing.T) {
+	p := &PgProc{replicas: &replicas{}}
+	if err := p.SetLocation(loadParis(t)); err == nil {
+		t.Errorf("Error expected an error setting the location after the replicas")
+	}
+}
+
+func TestSetLocation(t *testing.T) {
+	paris := loadParis(t)
+	p, _ := connect()
+	if err := p.SetLocation(time.Local); err == nil {
+		t.Errorf("Error expected an error for the Local location")
+	}
+	if err := p.SetLocation(paris); err != nil {
+		t.Errorf("Error setting location: %s", err)
+	}
+
+	input := time.Date(2017, 5, 9, 22, 30, 0, 0, time.UTC)
+	var text string
+	err := p.Call(&text, "tests", "test_returns_timestamptz_as_text", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_timestamptz_as_text")
+	}
+	if text != "2017-05-10 00:30:00+02" {
+		t.Errorf("Error expected session time zone Europe/Paris value is %s", text)
+	}
+
+	var res time.Time
+	err = p.Call(&res, "tests", "test_returns_same_timestamptz", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_timestamptz")
+	}
+	if !res.Equal(input) || res.Location() != paris {
+		t.Errorf("Error expected %s value is %s", input.In(paris), res)
+	}
+
+	err = p.Call(&res, "tests", "test_returns_same_timestamp", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_timestamp")
+	}
+	if !res.Equal(input) || res.Location() != paris {
+		t.Errorf("Error expected %s value is %s", input.In(paris), res)
+	}
+
+	err = p.Call(&res, "tests", "test_returns_same_date", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_date")
+	}
+	if !res.Equal(time.Date(2017, 5, 10, 0, 0, 0, 0, paris)) {
+		t.Errorf("Error expected 2017-05-10 in Europe/Paris value is %s", res)
+	}
+
+	err = p.Call(&res, "tests", "test_returns_same_time", input)
+	if err != nil {
+		t.Errorf("Error calling tests.test_returns_same_time")
+	}
+	if h, m, _ := res.Clock(); h != 0 || m != 30 || res.Location() != paris {
+		t.Errorf("Error expected 00:30 in Europe/Paris value is %s", res)
+	}
+}
+
+func TestReturnsSameTimestampInLocation(t *testing.T) {
+	p, _ := connect()
+	if err := p.SetLocation(time.UTC); err != nil {
+		t.Errorf("Error setting location: %s", err)
+	}
+	var res time.Time
+	input := time.Now().UTC().Truncate(time.Microsecond)
+	err := p.Call(&res, "tests", "test_returns_same_timestamp", input)
+	if err != nil {
+		t.Errorf("Error calling test_returns_same_timestamp")
+	}
+	if !res.Equal(input) {
+		t.Errorf("Error expected '%s' value is '%s'\n", input, res)
+	}
+}
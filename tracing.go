@@ -0,0 +1,63 @@
+package pgproc
+
+import (
+	"context"
+)
+
+// Tracer starts the spans tracing the calls, see SetTracer.
+// Its methods mirror the ones of OpenTelemetry, so that a Tracer
+// can delegate to an OpenTelemetry tracer in a few lines.
+type Tracer interface {
+	// Start starts a span named name, child of the span of ctx if any,
+	// and returns a context containing the new span
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is an attribute of a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SetTracer sets the tracer of the calls: each call produces a span named
+// schema.proc, with attributes for the arity, the number of rows and the
+// SQLSTATE of errors, and child spans for the catalog lookup and the execution.
+// SetTracer must be called before the PgProc is used.
+func (p *PgProc) SetTracer(tracer Tracer) {
+	p.tracer = tracer
+}
+
+// noopSpan is the span used without tracer
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attributes ...Attribute) {}
+func (noopSpan) RecordError(err error)                 {}
+func (noopSpan) End()                                  {}
+
+// startSpan starts a span with the tracer of p, if any
+func (p *PgProc) startSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	if p.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	ctx, span := p.tracer.Start(ctx, name)
+	span.SetAttributes(attributes...)
+	return ctx, span
+}
+
+// endSpan records err, if not nil, and ends span
+func endSpan(span Span, err error) {
+	if err != nil {
+		if code := sqlState(err); code != "" {
+			span.SetAttributes(Attribute{Key: "db.response.status_code", Value: code})
+		}
+		span.RecordError(err)
+	}
+	span.End()
+}
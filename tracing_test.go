@@ -0,0 +1,112 @@
+package pgproc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+// recordedSpan is a span recorded by recordingTracer
+type recordedSpan struct {
+	name       string
+	parent     *recordedSpan
+	attributes map[string]interface{}
+	errors     []error
+	ended      bool
+}
+
+func (s *recordedSpan) SetAttributes(attributes ...Attribute) {
+	for _, a := range attributes {
+		s.attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.errors = append(s.errors, err)
+}
+
+func (s *recordedSpan) End() {
+	s.ended = true
+}
+
+type spanKey struct{}
+
+// recordingTracer records the spans it starts
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attributes: map[string]interface{}{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestEndSpan(t *testing.T) {
+	var (
+		tracer recordingTracer
+		p      = PgProc{tracer: &tracer}
+	)
+	ctx, root := p.startSpan(context.Background(), "tests.proc", Attribute{Key: "pgproc.arity", Value: 2})
+	_, child := p.startSpan(ctx, "execute")
+	endSpan(child, &pq.Error{Code: "23505"})
+	endSpan(root, errors.New("failed"))
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("Error expected 2 spans: %d", len(tracer.spans))
+	}
+	r, c := tracer.spans[0], tracer.spans[1]
+	if c.parent != r || !r.ended || !c.ended {
+		t.Errorf("Error in spans: %+v %+v", r, c)
+	}
+	if r.attributes["pgproc.arity"] != 2 || len(r.errors) != 1 {
+		t.Errorf("Error in root span: %+v", r)
+	}
+	if _, found := r.attributes["db.response.status_code"]; found {
+		t.Errorf("Error unexpected SQLSTATE: %+v", r)
+	}
+	if c.attributes["db.response.status_code"] != "23505" || len(c.errors) != 1 {
+		t.Errorf("Error in child span: %+v", c)
+	}
+
+	// without tracer
+	var q PgProc
+	if _, span := q.startSpan(context.Background(), "tests.proc"); span != (noopSpan{}) {
+		t.Errorf("Error expected noop span: %#v", span)
+	}
+}
+
+func TestSetTracer(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	var tracer recordingTracer
+	p.SetTracer(&tracer)
+	var res int
+	if err := p.Call(&res, "tests", "test_returns_incremented_integer", 1); err != nil {
+		t.Fatalf("Error calling: %s", err)
+	}
+	if len(tracer.spans) != 3 {
+		t.Fatalf("Error expected 3 spans: %d", len(tracer.spans))
+	}
+	root, lookup, execute := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	if root.name != "tests.test_returns_incremented_integer" || root.attributes["pgproc.arity"] != 1 || root.attributes["pgproc.rows"] != 1 {
+		t.Errorf("Error in call span: %+v", root)
+	}
+	if lookup.name != "catalog lookup" || lookup.parent != root || execute.name != "execute" || execute.parent != root {
+		t.Errorf("Error in child spans: %+v %+v", lookup, execute)
+	}
+
+	tracer.spans = nil
+	var b bool
+	if err := p.Call(&b, "tests", "function_raising_exception"); err == nil {
+		t.Fatal("Error expected error")
+	}
+	if root := tracer.spans[0]; root.attributes["db.response.status_code"] == nil || len(root.errors) != 1 || !root.ended {
+		t.Errorf("Error in call span: %+v", root)
+	}
+}
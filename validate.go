@@ -0,0 +1,239 @@
+package pgproc
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// typeCategories gives the category of the PostgreSQL types pgproc can check
+// the Go types against; other types are supposed compatible with any Go type
+var typeCategories = map[string]string{
+	"bool":        "bool",
+	"int2":        "int",
+	"int4":        "int",
+	"int8":        "int",
+	"oid":         "int",
+	"float4":      "float",
+	"float8":      "float",
+	"numeric":     "numeric",
+	"text":        "string",
+	"varchar":     "string",
+	"bpchar":      "string",
+	"name":        "string",
+	"date":        "time",
+	"timestamp":   "time",
+	"timestamptz": "time",
+	"time":        "time",
+	"timetz":      "time",
+	"uuid":        "uuid",
+	"inet":        "inet",
+	"cidr":        "inet",
+	"macaddr":     "macaddr",
+	"macaddr8":    "macaddr",
+	"void":        "void",
+}
+
+var (
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	rawJSONType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// compatible returns true if values of the PostgreSQL type typname
+// can be converted from and to values of the Go type t
+func (p *PgProc) compatible(t reflect.Type, typname string) bool {
+	if _, found := p.codecs[typname]; found {
+		return true
+	}
+	if t.Kind() == reflect.Interface || t.Kind() == reflect.String || t == bytesType || t == rawJSONType {
+		// any value can be sent and read in its textual form
+		return true
+	}
+	if reflect.PtrTo(t).Implements(scannerType) || t.Implements(valuerType) {
+		// the type knows how to handle the values by itself
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		return p.compatible(t.Elem(), typname)
+	}
+	if isArrayType(typname) {
+		return t.Kind() == reflect.Slice && p.compatible(t.Elem(), typname[1:])
+	}
+	category, found := typeCategories[typname]
+	if !found {
+		// enums, domains, types of extensions...
+		return t.Kind() != reflect.Struct || t == timeType
+	}
+	switch category {
+	case "bool":
+		return t.Kind() == reflect.Bool
+	case "int":
+		return isInteger(t) || t == intType || t == ratType
+	case "float":
+		return isFloat(t)
+	case "numeric":
+		return isInteger(t) || isFloat(t) || t == intType || t == ratType
+	case "time":
+		return t == timeType
+	case "uuid":
+		return t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8
+	case "inet":
+		return t == ipType || t == ipNetType || t == addrType || t == prefixType
+	case "macaddr":
+		return t == hardwareAddrType
+	}
+	return false
+}
+
+func isInteger(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isFloat(t reflect.Type) bool {
+	return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+}
+
+// checkParams checks that the Go types of the parameters are compatible
+// with the types of the arguments of a function
+func (p *PgProc) checkParams(types []reflect.Type, rt *returnType) error {
+	for i, t := range types {
+		if i < len(rt.argTypes) && !p.compatible(t, rt.argTypes[i]) {
+			return fmt.Errorf("parameter %d: %s is not compatible with %s", i+1, t, rt.argTypes[i])
+		}
+	}
+	return nil
+}
+
+// checkResult checks that the result of a function can be stored into
+// a value of the Go type t: a struct for a composite result, a slice
+// for a SETOF result
+func (p *PgProc) checkResult(t reflect.Type, rt *returnType) error {
+	if rt.setof {
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Chan {
+			return fmt.Errorf("result: %s is not a slice or a channel for a SETOF result", t)
+		}
+		t = t.Elem()
+	}
+	if rt.scalar {
+		if rt.scalarType == "void" {
+			return errors.New("result: function returns void")
+		}
+		if rt.scalarType == "json" || rt.scalarType == "jsonb" {
+			return nil
+		}
+		if !p.compatible(t, rt.scalarType) {
+			return fmt.Errorf("result: %s is not compatible with %s", t, rt.scalarType)
+		}
+		return nil
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("result: %s is not a struct for a composite result", t)
+	}
+	for i, name := range rt.compositeNames {
+		f, found := compositeField(t, name)
+		if !found {
+			return fmt.Errorf("result: field %s not found in %s", name, t)
+		}
+		if !p.compatible(f.Type, rt.compositeTypes[i]) {
+			return fmt.Errorf("result: field %s of %s is not compatible with %s", f.Name, t, rt.compositeTypes[i])
+		}
+	}
+	return nil
+}
+
+// compositeField returns the field of the struct type t storing
+// the attribute name of a composite type
+func compositeField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if f, found := t.FieldByName(strings.Title(name)); found {
+		return f, true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Tag.Get("pgproc") == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// registeredCall is a call registered to be checked by ValidateAll
+type registeredCall struct {
+	schema string
+	proc   string
+	result interface{}
+	params []interface{}
+}
+
+// Validate checks that the procedure schema.proc exists with as many
+// arguments as params, that it is callable, and that the values params
+// and result, prototypes of the values passed to Call, are compatible with
+// the types of its arguments and of its result: for a composite result,
+// each attribute must be found in the struct, by name or by pgproc tag,
+// and have a compatible type. A nil result is not checked.
+func (p *PgProc) Validate(schema string, proc string, result interface{}, params ...interface{}) error {
+	if err := p.checkPolicy(context.Background(), schema, proc, len(params)); err != nil {
+		return fmt.Errorf("%s.%s: %w", schema, proc, err)
+	}
+	rt, err := p.getReturnType(context.Background(), schema, proc, len(params))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%s.%s: function with %d arguments not found", schema, proc, len(params))
+	}
+	if err != nil {
+		return fmt.Errorf("%s.%s: %w", schema, proc, err)
+	}
+	var types []reflect.Type
+	for _, param := range params {
+		if param == nil {
+			// NULL is compatible with any type
+			types = append(types, reflect.TypeOf((*interface{})(nil)).Elem())
+			continue
+		}
+		types = append(types, reflect.TypeOf(param))
+	}
+	if err := p.checkParams(types, rt); err != nil {
+		return fmt.Errorf("%s.%s: %s", schema, proc, err)
+	}
+	if result == nil {
+		return nil
+	}
+	t := reflect.TypeOf(result)
+	if t.Kind() == reflect.Ptr {
+		// the result is passed to Call as a pointer
+		t = t.Elem()
+	}
+	if err := p.checkResult(t, rt); err != nil {
+		return fmt.Errorf("%s.%s: %s", schema, proc, err)
+	}
+	return nil
+}
+
+// Register registers a call to be checked by ValidateAll, with
+// prototypes of its result and parameters as for Validate.
+// Register must be called before the PgProc is used.
+func (p *PgProc) Register(schema string, proc string, result interface{}, params ...interface{}) {
+	p.calls = append(p.calls, registeredCall{schema: schema, proc: proc, result: result, params: params})
+}
+
+// ValidateAll validates all the registered calls, and returns an error
+// listing all the invalid ones
+func (p *PgProc) ValidateAll() error {
+	var errs []string
+	for _, call := range p.calls {
+		if err := p.Validate(call.schema, call.proc, call.result, call.params...); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid calls: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package pgproc
+
+import (
+	"database/sql"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompatible(t *testing.T) {
+	p := &PgProc{}
+	compatibles := []struct {
+		value   interface{}
+		typname string
+		ok      bool
+	}{
+		{1, "int4", true},
+		{int64(1), "int8", true},
+		{"1", "int4", true},
+		{1.5, "int4", false},
+		{true, "int4", false},
+		{1.5, "float8", true},
+		{big.NewRat(1, 2), "numeric", true},
+		{Decimal("1.5"), "numeric", true},
+		{time.Now(), "timestamptz", true},
+		{time.Now(), "int4", false},
+		{UUID{}, "uuid", true},
+		{net.IP{}, "inet", true},
+		{[]int{1}, "_int4", true},
+		{[]bool{true}, "_int4", false},
+		{1, "_int4", false},
+		{Content{}, "some_enum", false},
+		{"red", "some_enum", true},
+	}
+	for _, c := range compatibles {
+		if ok := p.compatible(reflect.TypeOf(c.value), c.typname); ok != c.ok {
+			t.Errorf("Error compatible(%T, %s) = %v", c.value, c.typname, ok)
+		}
+	}
+}
+
+func TestValidateUnreachable(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost")
+	if err != nil {
+		t.Fatalf("Error opening: %s", err)
+	}
+	db.Close()
+	p := &PgProc{db: db}
+	var i int
+	if err := p.Validate("tests", "test_returns_incremented_integer", &i, 1); err == nil || strings.Contains(err.Error(), "not found") {
+		t.Errorf("Error expected lookup error: %v", err)
+	}
+	p.Register("tests", "test_returns_incremented_integer", &i, 1)
+	if err := p.ValidateAll(); err == nil {
+		t.Errorf("Error expected lookup error validating all")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var i int
+	if err := base.Validate("tests", "test_returns_incremented_integer", &i, 1); err != nil {
+		t.Errorf("Error validating: %s", err)
+	}
+	if err := base.Validate("tests", "content_get", &Content{}, 1); err != nil {
+		t.Errorf("Error validating composite: %s", err)
+	}
+	var composites []struct {
+		A int
+		B string
+	}
+	if err := base.Validate("tests", "test_returns_setof_composite", &composites); err != nil {
+		t.Errorf("Error validating setof composite: %s", err)
+	}
+	if err := base.Validate("tests", "test_returns_incremented_integer", nil, 1); err != nil {
+		t.Errorf("Error validating without result: %s", err)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	var (
+		i int
+		b bool
+		s []string
+	)
+	var missing struct {
+		CntId int `pgproc:"cnt_id"`
+	}
+	var wrong struct {
+		CntId   bool   `pgproc:"cnt_id"`
+		CntName string `pgproc:"cnt_name"`
+	}
+	calls := []struct {
+		proc   string
+		result interface{}
+		params []interface{}
+	}{
+		{"unknown_function", &i, nil},
+		{"_hidden_function", &b, nil},
+		{"test_returns_incremented_integer", &i, []interface{}{1, 2}},
+		{"test_returns_incremented_integer", &i, []interface{}{true}},
+		{"test_returns_incremented_integer", &b, []interface{}{1}},
+		{"test_returns_incremented_integer", &s, []interface{}{1}},
+		{"content_get", &missing, []interface{}{1}},
+		{"content_get", &wrong, []interface{}{1}},
+		{"content_get", &i, []interface{}{1}},
+	}
+	for _, c := range calls {
+		if err := base.Validate("tests", c.proc, c.result, c.params...); err == nil {
+			t.Errorf("Error expected validating %s with %T %v", c.proc, c.result, c.params)
+		}
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	p, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err)
+	}
+	var (
+		i int
+		b bool
+	)
+	p.Register("tests", "test_returns_incremented_integer", &i, 1)
+	p.Register("tests", "content_get", &Content{}, 1)
+	if err := p.ValidateAll(); err != nil {
+		t.Errorf("Error validating all: %s", err)
+	}
+	p.Register("tests", "unknown_function", &i)
+	p.Register("tests", "test_returns_incremented_integer", &b, 1)
+	err = p.ValidateAll()
+	if err == nil || strings.Count(err.Error(), "tests.") != 2 {
+		t.Errorf("Error expected 2 invalid calls: %v", err)
+	}
+}